@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var InvalidArticleRefError = errors.New("INVALID_ARTICLE_REF")
+
+const aidTable = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_"
+
+var articleUrlRegexp = regexp.MustCompile(`^(?:https?://)?(?:www\.)?ptt\.cc/bbs/([0-9A-Za-z_\-]+)/([MG]\.\d+\.A(?:\.[0-9A-Fa-f]{1,3})?)\.html(?:[?#].*)?$`)
+var articleFilenameRegexp = regexp.MustCompile(`^([MG])\.(\d+)\.A(?:\.([0-9A-Fa-f]{1,3}))?$`)
+var articleAidFormRegexp = regexp.MustCompile(`^(#?)([0-9A-Za-z\-_]{8})$`)
+
+// board names start with a letter, the AIDs of M. and G. files always start with a digit
+var boardNameRegexp = regexp.MustCompile(`^[A-Za-z][0-9A-Za-z\-_]*$`)
+
+// aidForm returns the AID without #, the # can only be left out when the AID can't be a board name
+func aidForm(ref string) (string, bool) {
+	m := articleAidFormRegexp.FindStringSubmatch(ref)
+	if m == nil || (m[1] == "" && boardNameRegexp.MatchString(m[2])) {
+		return "", false
+	}
+	return m[2], true
+}
+
+// FilenameToAid converts M.1681234567.A.1C3 to #1aBcDeFg, see pttbbs common/sys/aids.c
+func FilenameToAid(filename string) (string, error) {
+	m := articleFilenameRegexp.FindStringSubmatch(filename)
+	if m == nil {
+		return "", InvalidArticleRefError
+	}
+	var kind uint64
+	if m[1] == "G" {
+		kind = 1
+	}
+	timestamp, err := strconv.ParseUint(m[2], 10, 32)
+	if err != nil {
+		return "", InvalidArticleRefError
+	}
+	var random uint64
+	if m[3] != "" {
+		random, _ = strconv.ParseUint(m[3], 16, 12)
+	}
+
+	aidu := kind<<44 | timestamp<<12 | random
+	aid := make([]byte, 8)
+	for i := len(aid) - 1; i >= 0; i-- {
+		aid[i] = aidTable[aidu&0x3f]
+		aidu >>= 6
+	}
+	return "#" + string(aid), nil
+}
+
+func AidToFilename(aid string) (string, error) {
+	form, ok := aidForm(aid)
+	if !ok {
+		return "", InvalidArticleRefError
+	}
+	var aidu uint64
+	for _, c := range []byte(form) {
+		aidu = aidu<<6 | uint64(strings.IndexByte(aidTable, c))
+	}
+
+	kind := "M"
+	if (aidu>>44)&0xf == 1 {
+		kind = "G"
+	}
+	return fmt.Sprintf("%s.%d.A.%03X", kind, (aidu>>12)&0xffffffff, aidu&0xfff), nil
+}
+
+func ArticleUrl(board string, aid string) (string, error) {
+	filename, err := AidToFilename(aid)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("https://www.ptt.cc/bbs/%s/%s.html", board, filename), nil
+}
+
+// ParseArticleRef accepts an article URL, a filename (M.timestamp.A.xxx) or an AID,
+// the # of the AID is needed when the rest could be a board name like Baseball,
+// returns the board when the reference contains it and the #AID
+func ParseArticleRef(ref string) (board string, aid string, err error) {
+	ref = strings.TrimSpace(ref)
+	if m := articleUrlRegexp.FindStringSubmatch(ref); m != nil {
+		aid, err = FilenameToAid(m[2])
+		return m[1], aid, err
+	}
+	if articleFilenameRegexp.MatchString(ref) {
+		aid, err = FilenameToAid(ref)
+		return "", aid, err
+	}
+	if form, ok := aidForm(ref); ok {
+		return "", "#" + form, nil
+	}
+	return "", "", InvalidArticleRefError
+}
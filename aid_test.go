@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// pairs computed with the bit layout of pttbbs common/sys/aids.c
+var aidPairs = []struct {
+	filename string
+	aid      string
+}{
+	{"M.1681234567.A.1C3", "#1aDPg773"},
+	{"M.1496563127.A.5F1", "#1PCxstNn"},
+	{"M.1000000000.A.FFF", "#0xcie0__"},
+	{"G.1100000000.A.000", "#51aAi000"},
+}
+
+func TestFilenameToAid(t *testing.T) {
+	for _, p := range aidPairs {
+		aid, err := FilenameToAid(p.filename)
+		if err != nil || aid != p.aid {
+			t.Errorf("FilenameToAid(%q) = %q, %v, want %q", p.filename, aid, err, p.aid)
+		}
+		filename, err := AidToFilename(p.aid)
+		if err != nil || filename != p.filename {
+			t.Errorf("AidToFilename(%q) = %q, %v, want %q", p.aid, filename, err, p.filename)
+		}
+	}
+	// the random part is optional in old file names
+	if aid, err := FilenameToAid("G.1100000000.A"); err != nil || aid != "#51aAi000" {
+		t.Errorf("FilenameToAid without random = %q, %v", aid, err)
+	}
+	for _, aid := range []string{"Baseball", "#1aDPg77", "#1aDPg77!"} {
+		if _, err := AidToFilename(aid); !errors.Is(err, InvalidArticleRefError) {
+			t.Errorf("AidToFilename(%q) error %v", aid, err)
+		}
+	}
+}
+
+func TestParseArticleRef(t *testing.T) {
+	cases := []struct {
+		ref   string
+		board string
+		aid   string
+		err   error
+	}{
+		{"https://www.ptt.cc/bbs/Gossiping/M.1681234567.A.1C3.html", "Gossiping", "#1aDPg773", nil},
+		{"http://ptt.cc/bbs/Test/M.1681234567.A.1C3.html", "Test", "#1aDPg773", nil},
+		{"www.ptt.cc/bbs/Test/G.1100000000.A.000.html", "Test", "#51aAi000", nil},
+		{"https://www.ptt.cc/bbs/Gossiping/M.1681234567.A.1C3.html?from=share", "Gossiping", "#1aDPg773", nil},
+		{"https://www.ptt.cc/bbs/Gossiping/M.1681234567.A.1C3.html#push-12", "Gossiping", "#1aDPg773", nil},
+		{" M.1681234567.A.1C3 ", "", "#1aDPg773", nil},
+		{"#1aDPg773", "", "#1aDPg773", nil},
+		{"1aDPg773", "", "#1aDPg773", nil},
+		// 8 letters could be a board name, only the # makes it an AID
+		{"Baseball", "", "", InvalidArticleRefError},
+		{"#Baseball", "", "#Baseball", nil},
+		{"1aDPg77", "", "", InvalidArticleRefError},
+		{"https://www.ptt.cc/bbs/Gossiping/index.html", "", "", InvalidArticleRefError},
+		{"", "", "", InvalidArticleRefError},
+	}
+	for _, c := range cases {
+		board, aid, err := ParseArticleRef(c.ref)
+		if board != c.board || aid != c.aid || !errors.Is(err, c.err) {
+			t.Errorf("ParseArticleRef(%q) = %q, %q, %v, want %q, %q, %v", c.ref, board, aid, err, c.board, c.aid, c.err)
+		}
+	}
+}
+
+func TestArticleUrl(t *testing.T) {
+	url, err := ArticleUrl("Gossiping", "#1aDPg773")
+	if err != nil || url != "https://www.ptt.cc/bbs/Gossiping/M.1681234567.A.1C3.html" {
+		t.Fatalf("ArticleUrl = %q, %v", url, err)
+	}
+	board, aid, err := ParseArticleRef(url)
+	if err != nil || board != "Gossiping" || aid != "#1aDPg773" {
+		t.Fatalf("ParseArticleRef(%q) = %q, %q, %v", url, board, aid, err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RequestBudget is a token bucket on the keys sent to PTT, clients logged in with the same
+// account can share one so all their watchers together stay under the limit
+type RequestBudget struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRequestBudget allows perSecond requests on average and burst at once, perSecond 0 is unlimited
+func NewRequestBudget(perSecond float64, burst int) *RequestBudget {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RequestBudget{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait takes one request from the budget, blocking until one is available or ctx is done
+func (b *RequestBudget) Wait(ctx context.Context) error {
+	if b == nil || b.rate <= 0 {
+		return nil
+	}
+	for {
+		b.lock.Lock()
+		now := time.Now()
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.lock.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.lock.Unlock()
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	colorReset  = "\x1b[m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorGray   = "\x1b[90m"
+	colorCyan   = "\x1b[36m"
+	// highlighted messages by the rules
+	colorReverse = "\x1b[7m"
+)
+
+// chatView splits the terminal with a scroll region, the pushes scroll on top and
+// the input line stays at the bottom below a separator
+type chatView struct {
+	lock sync.Mutex
+	out  io.Writer
+	rows int
+	cols int
+}
+
+func newChatView(out io.Writer) *chatView {
+	rows, cols := terminalSize()
+	v := &chatView{out: out, rows: rows, cols: cols}
+	// clear, keep the last two rows out of the scroll region
+	fmt.Fprintf(v.out, "\x1b[2J\x1b[1;%dr", v.rows-2)
+	fmt.Fprintf(v.out, "\x1b[%d;1H%s%s%s", v.rows-1, colorGray, strings.Repeat("─", v.cols), colorReset)
+	v.prompt()
+	return v
+}
+
+// isTerminal reports whether f is a character device, the chat view needs one
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// terminalSize asks stty for the size of the terminal on stdin, 24x80 when it can't tell
+func terminalSize() (int, int) {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err == nil {
+		fields := strings.Fields(string(out))
+		if len(fields) == 2 {
+			rows, rowsErr := strconv.Atoi(fields[0])
+			cols, colsErr := strconv.Atoi(fields[1])
+			if rowsErr == nil && colsErr == nil && rows > 3 && cols > 0 {
+				return rows, cols
+			}
+		}
+	}
+	return screenRows, screenCols
+}
+
+func messageColor(t string) string {
+	switch t {
+	case "推":
+		return colorGreen
+	case "噓":
+		return colorRed
+	}
+	return colorYellow
+}
+
+func (v *chatView) printMessages(messages []Message) {
+	for i := range messages {
+		m := &messages[i]
+		content := m.Message
+		if m.Highlight {
+			content = colorReverse + content + colorReset
+		}
+		tags := ""
+		if len(m.Tags) > 0 {
+			tags = colorCyan + messageTags(m) + colorReset + " "
+		}
+		v.printLine(fmt.Sprintf("%s%s %s%s%s: %s%s %s%s%s", messageColor(m.Type), m.Type, colorYellow, m.User, colorReset,
+			tags, content, colorGray, m.Time.Format("01/02 15:04"), colorReset))
+	}
+}
+
+func (v *chatView) status(format string, a ...interface{}) {
+	v.printLine(colorGray + "-- " + fmt.Sprintf(format, a...) + colorReset)
+}
+
+func (v *chatView) error(format string, a ...interface{}) {
+	v.printLine(colorRed + "!! " + fmt.Sprintf(format, a...) + colorReset)
+}
+
+// printLine scrolls the region up by one and writes on its last row, the cursor goes back to the input
+func (v *chatView) printLine(line string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	fmt.Fprintf(v.out, "\x1b7\x1b[%d;1H\r\n%s\x1b8", v.rows-2, line)
+}
+
+// prompt clears the input line after a line was read
+func (v *chatView) prompt() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	fmt.Fprintf(v.out, "\x1b[%d;1H\x1b[2K> ", v.rows)
+}
+
+// close resets the scroll region and leaves the cursor at the bottom
+func (v *chatView) close() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	fmt.Fprintf(v.out, "\x1b[r\x1b[%d;1H\r\n", v.rows)
+}
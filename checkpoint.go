@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Checkpoint is the last message emitted for an article, Line is its line in the article
+// and User, Type and Message tell whether the line still holds it
+type Checkpoint struct {
+	Board   string    `json:"board"`
+	Article string    `json:"article"`
+	Line    int       `json:"line"`
+	Hash    string    `json:"hash"`
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+	Updated time.Time `json:"updated"`
+}
+
+// CheckpointStore keeps one JSON file per article in a directory
+type CheckpointStore struct {
+	dir string
+}
+
+func NewCheckpointStore(dir string) (*CheckpointStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &CheckpointStore{dir: dir}, nil
+}
+
+// the AID alphabet is safe in file names once the # is gone
+func (s *CheckpointStore) path(board string, aid string) string {
+	return filepath.Join(s.dir, strings.ToLower(board)+"-"+strings.TrimPrefix(aid, "#")+".json")
+}
+
+// Load returns the checkpoint of the article, nil when there is none yet
+func (s *CheckpointStore) Load(board string, aid string) (*Checkpoint, error) {
+	data, err := os.ReadFile(s.path(board, aid))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{}
+	if err = json.Unmarshal(data, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// Save writes a temporary file and renames it, so a crash never leaves half a checkpoint
+func (s *CheckpointStore) Save(cp *Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	path := s.path(cp.Board, cp.Article)
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func messageHash(m *Message) string {
+	sum := sha256.Sum256([]byte(m.Type + "\x00" + m.User + "\x00" + m.Message + "\x00" + m.Time.Format("01/02 15:04")))
+	return hex.EncodeToString(sum[:16])
+}
+
+func newCheckpoint(board string, aid string, m *Message) *Checkpoint {
+	return &Checkpoint{
+		Board:   board,
+		Article: aid,
+		Line:    m.Line,
+		Hash:    messageHash(m),
+		Time:    m.Time,
+		User:    m.User,
+		Type:    m.Type,
+		Message: m.Message,
+		Updated: time.Now(),
+	}
+}
+
+// lastMessage stands for the checkpoint when the next page is parsed
+func (cp *Checkpoint) lastMessage() *Message {
+	return &Message{Line: cp.Line, Time: cp.Time, User: cp.User, Type: cp.Type, Message: cp.Message}
+}
+
+// after returns the messages after the checkpoint, the line is trusted when the message
+// there still has the hash, otherwise the article was edited and the hash is searched for
+func (cp *Checkpoint) after(messages []Message) []Message {
+	for i := range messages {
+		if messages[i].Line == cp.Line && messageHash(&messages[i]) == cp.Hash {
+			return messages[i+1:]
+		}
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messageHash(&messages[i]) == cp.Hash {
+			return messages[i+1:]
+		}
+	}
+	for i := range messages {
+		if messages[i].Line > cp.Line {
+			return messages[i:]
+		}
+	}
+	return nil
+}
+
+// backfill reads the whole article and returns the messages posted after the checkpoint
+func (ptt *PttClient) backfill(ctx context.Context, board string, aid string, cp *Checkpoint) ([]Message, error) {
+	article, err := ptt.ReadArticle(ctx, board, aid)
+	if err != nil {
+		return nil, err
+	}
+	return cp.after(article.Messages), nil
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+func runPull(ctx context.Context, flags *flag.FlagSet, options *cliOptions, args []string) error {
+	poll := PollOptions{}
+	sinks, checkpoints, rules := pollFlags(flags, &poll)
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	board, article, err := resolveArticle(options.board, options.article)
+	if err != nil {
+		return err
+	}
+	if poll.Checkpoints, err = openCheckpoints(*checkpoints); err != nil {
+		return err
+	}
+	if poll.Rules, err = openRules(*rules); err != nil {
+		return err
+	}
+	handler, closeSinks, err := withSinks(ctx, *sinks, board, article, messagePrinter(options))
+	if err != nil {
+		return err
+	}
+	defer closeSinks()
+
+	ptt, err := login(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer logout(ptt)
+
+	poll.Handler = handler
+	return ptt.PullMessages(ctx, board, article, poll)
+}
+
+func runPush(ctx context.Context, flags *flag.FlagSet, options *cliOptions, args []string) error {
+	if err := parseFlags(flags, args, -1); err != nil {
+		return err
+	}
+	message := strings.Join(flags.Args(), " ")
+	if message == "" {
+		return fmt.Errorf("%w: push needs a message", usageError)
+	}
+	board, article, err := resolveArticle(options.board, options.article)
+	if err != nil {
+		return err
+	}
+
+	ptt, err := login(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer logout(ptt)
+
+	if err = ptt.PushTo(ctx, board, article, message); err != nil {
+		return err
+	}
+	if options.json {
+		return json.NewEncoder(os.Stdout).Encode(map[string]string{"board": board, "article": article, "message": message})
+	}
+	return nil
+}
+
+// chat prints the pushes like pull and pushes every line read from stdin, on a terminal
+// the pushes scroll above an input line with the send status shown inline
+func runChat(ctx context.Context, flags *flag.FlagSet, options *cliOptions, args []string) error {
+	poll := PollOptions{}
+	sinks, checkpoints, rules := pollFlags(flags, &poll)
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	board, article, err := resolveArticle(options.board, options.article)
+	if err != nil {
+		return err
+	}
+	if poll.Checkpoints, err = openCheckpoints(*checkpoints); err != nil {
+		return err
+	}
+	if poll.Rules, err = openRules(*rules); err != nil {
+		return err
+	}
+
+	ptt, err := login(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer logout(ptt)
+	// stop the pull before the logout when stdin ends
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err = ptt.EnterBoard(ctx, board); err != nil {
+		return err
+	}
+	if err = ptt.EnterArticle(ctx, article); err != nil {
+		return err
+	}
+
+	// the split view only makes sense on a terminal, pipes get the plain pull output
+	var view *chatView
+	handler := messagePrinter(options)
+	if !options.json && isTerminal(os.Stdin) && isTerminal(os.Stdout) {
+		view = newChatView(os.Stdout)
+		defer view.close()
+		handler = func(messages []Message) error {
+			view.printMessages(messages)
+			return nil
+		}
+		ptt.WaterBallHandler = func(w WaterBall) {
+			view.status("水球 %s: %s", w.From, w.Message)
+		}
+		view.status("%s %s", board, article)
+	}
+
+	handler, closeSinks, err := withSinks(ctx, *sinks, board, article, handler)
+	if err != nil {
+		return err
+	}
+	defer closeSinks()
+
+	poll.Handler = handler
+	pulled := make(chan error, 1)
+	go func() {
+		pulled <- ptt.PullMessages(ctx, board, article, poll)
+	}()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	for {
+		select {
+		case err = <-pulled:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			if strings.TrimSpace(line) == "" {
+				if view != nil {
+					view.prompt()
+				}
+				continue
+			}
+			if view == nil {
+				if err = ptt.PushTo(ctx, board, article, line); err != nil {
+					logError("push", err)
+				}
+				continue
+			}
+			view.prompt()
+			view.status("送出 %s", line)
+			if err = ptt.PushTo(ctx, board, article, line); err != nil {
+				view.error("%s: %s", describeError(err), line)
+			} else {
+				view.status("已推文")
+			}
+		}
+	}
+}
+
+func runRead(ctx context.Context, flags *flag.FlagSet, options *cliOptions, args []string) error {
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	ptt, err := login(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer logout(ptt)
+
+	article, err := ptt.ReadArticle(ctx, options.board, options.article)
+	if err != nil {
+		return err
+	}
+	if options.json {
+		return json.NewEncoder(os.Stdout).Encode(article)
+	}
+	fmt.Printf("作者 %s\n標題 %s\n時間 %s\n\n%s\n\n", article.Author, article.Title, article.Time.Format(time.ANSIC), article.Content)
+	printMessages(article.Messages)
+	return nil
+}
+
+// tally counts the votes of the whole article and keeps counting the new pushes, the result
+// is printed again after every poll with new votes
+func runTally(ctx context.Context, flags *flag.FlagSet, options *cliOptions, args []string) error {
+	poll := PollOptions{}
+	flags.DurationVar(&poll.MinInterval, "min-interval", time.Second, "poll interval while messages keep coming")
+	flags.DurationVar(&poll.MaxInterval, "max-interval", 30*time.Second, "longest poll interval of a quiet article")
+	choices := flags.String("options", "", "comma separated options like 1,2,3, the first word of any push when empty")
+	lastWins := flags.Bool("last", false, "count the last vote of a user instead of the first")
+	start := flags.String("start", "", "count pushes from this time, like 04/01 20:00")
+	end := flags.String("end", "", "count pushes until this time, like 04/01 21:00")
+	fromFloor := flags.Int("from-floor", 0, "count pushes from this floor, the number of the push in the article")
+	toFloor := flags.Int("to-floor", 0, "count pushes until this floor, the number of the push in the article")
+	once := flags.Bool("once", false, "print the result of the article and exit")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	tallyOptions, err := parseTallyOptions(*choices, *lastWins, *start, *end, *fromFloor, *toFloor)
+	if err != nil {
+		return err
+	}
+	board, article, err := resolveArticle(options.board, options.article)
+	if err != nil {
+		return err
+	}
+
+	ptt, err := login(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer logout(ptt)
+
+	tally := NewTally(tallyOptions)
+	encoder := json.NewEncoder(os.Stdout)
+	show := func() {
+		if options.json {
+			if err := encoder.Encode(tally.Result()); err != nil {
+				logError("encode tally", err)
+			}
+			return
+		}
+		fmt.Printf("%s\n\n", tally.Result())
+	}
+
+	read, err := ptt.ReadArticle(ctx, board, article)
+	if err != nil {
+		return err
+	}
+	tally.Add(read.Messages)
+	show()
+	if *once {
+		return nil
+	}
+
+	// the pull goes on after the last push read, the tally gets every push once
+	if n := len(read.Messages); n > 0 {
+		poll.After = &read.Messages[n-1]
+	}
+	poll.Handler = func(messages []Message) error {
+		tally.Add(messages)
+		show()
+		return nil
+	}
+	return ptt.PullMessages(ctx, board, article, poll)
+}
+
+// raffle reads every push of the article and draws the winners among the eligible ones, the
+// report lists the seed and the candidates so the draw can be checked again
+func runRaffle(ctx context.Context, flags *flag.FlagSet, options *cliOptions, args []string) error {
+	raffle := RaffleOptions{}
+	flags.StringVar(&raffle.Keyword, "keyword", "", "only pushes containing it enter, any push when empty")
+	types := flags.String("types", "", "comma separated push types that enter, like 推, any when empty")
+	deadline := flags.String("deadline", "", "pushes after it don't enter, like 04/01 20:00")
+	flags.BoolVar(&raffle.OneEntry, "one-entry", true, "only the first eligible push of a user enters")
+	exclude := flags.String("exclude", "", "comma separated users who can't win")
+	flags.IntVar(&raffle.Winners, "winners", 1, "number of winners")
+	flags.Int64Var(&raffle.Seed, "seed", 0, "seed of the draw, the current time when 0")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	raffle.Types = splitList(*types)
+	raffle.Exclude = splitList(*exclude)
+	var err error
+	if raffle.Deadline, err = ParseTallyTime(*deadline); err != nil {
+		return fmt.Errorf("%w: deadline: %s", usageError, err)
+	}
+	if raffle.Seed == 0 {
+		raffle.Seed = time.Now().UnixNano()
+	}
+
+	ptt, err := login(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer logout(ptt)
+
+	article, err := ptt.ReadArticle(ctx, options.board, options.article)
+	if err != nil {
+		return err
+	}
+	report := Raffle(article, raffle)
+	if options.json {
+		return json.NewEncoder(os.Stdout).Encode(report)
+	}
+	report.Print(os.Stdout)
+	return nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func runList(ctx context.Context, flags *flag.FlagSet, options *cliOptions, args []string) error {
+	list := ListArticlesOptions{}
+	flags.IntVar(&list.Pages, "pages", 1, "screens to read from the newest article")
+	flags.BoolVar(&list.ResolveAid, "aid", false, "query the AID of every article, one more round trip each")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	if options.board == "" {
+		return fmt.Errorf("%w: list needs a board", usageError)
+	}
+
+	ptt, err := login(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer logout(ptt)
+
+	entries, err := ptt.ListArticles(ctx, options.board, list)
+	if err != nil {
+		return err
+	}
+	if options.json {
+		return json.NewEncoder(os.Stdout).Encode(entries)
+	}
+	for _, e := range entries {
+		fmt.Printf("%7d %-9s %2s %5s %-12s %s\n", e.Serial, e.Aid, e.PushText, e.Date, e.Author, e.Title)
+	}
+	return nil
+}
+
+// pollFlags registers the flags pull and chat share
+func pollFlags(flags *flag.FlagSet, poll *PollOptions) (sinks *string, checkpoints *string, rules *string) {
+	flags.DurationVar(&poll.MinInterval, "min-interval", time.Second, "poll interval while messages keep coming")
+	flags.DurationVar(&poll.MaxInterval, "max-interval", 30*time.Second, "longest poll interval of a quiet article")
+	flags.BoolVar(&poll.Backfill, "backfill", true, "read the whole article at start for the messages since the checkpoint")
+	sinks = flags.String("sinks", os.Getenv("sinks"), "JSON file of the sinks the messages also go to, $sinks by default")
+	checkpoints = flags.String("checkpoints", os.Getenv("checkpoints"), "directory of the checkpoints to resume from, $checkpoints by default")
+	rules = flags.String("rules", os.Getenv("rules"), "JSON file of the rules to drop, tag or highlight messages, read again when it changes, $rules by default")
+	return sinks, checkpoints, rules
+}
+
+func openRules(path string) (*RuleEngine, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return NewRuleEngine(path)
+}
+
+func openCheckpoints(dir string) (*CheckpointStore, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	return NewCheckpointStore(dir)
+}
+
+// withSinks adds the sinks configured for the article in the sinks file to handler, the
+// returned func closes them, a sink error keeps the checkpoint so the messages come again
+// and handler doesn't get the ones it had already
+func withSinks(ctx context.Context, path string, board string, article string, handler func([]Message) error) (func([]Message) error, func(), error) {
+	if path == "" {
+		return handler, func() {}, nil
+	}
+	sink, err := LoadSinks(path, board, article)
+	if err != nil {
+		return nil, nil, err
+	}
+	var handled []Message
+	return func(messages []Message) error {
+			if fresh := undelivered(handled, messages); len(fresh) > 0 {
+				if err := handler(fresh); err != nil {
+					return err
+				}
+			}
+			handled = messages
+			if err := sink.Write(ctx, board, article, messages); err != nil {
+				return err
+			}
+			handled = nil
+			return nil
+		}, func() {
+			if err := sink.Close(); err != nil {
+				logError("close sink", err)
+			}
+		}, nil
+}
+
+// parseFlags parses the flags of the command, positional is the count of arguments left, -1 for any
+func parseFlags(flags *flag.FlagSet, args []string, positional int) error {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return fmt.Errorf("%w: %s", usageError, err)
+	}
+	if positional >= 0 && flags.NArg() != positional {
+		return fmt.Errorf("%w: unexpected arguments %v", usageError, flags.Args())
+	}
+	return nil
+}
+
+// messagePrinter prints messages as text, or one JSON object per line with --json
+func messagePrinter(options *cliOptions) func([]Message) error {
+	if !options.json {
+		return func(messages []Message) error {
+			printMessages(messages)
+			return nil
+		}
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	return func(messages []Message) error {
+		for i := range messages {
+			if err := encoder.Encode(&messages[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// waterBallPrinter prints water balls like messages, with --json as {"waterBall": {...}}
+func waterBallPrinter(options *cliOptions) func(WaterBall) {
+	if !options.json {
+		return func(w WaterBall) {
+			fmt.Printf("水球 %s: %s %s\n", w.From, w.Message, w.Time.Format("01/02 15:04"))
+		}
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	return func(w WaterBall) {
+		if err := encoder.Encode(map[string]WaterBall{"waterBall": w}); err != nil {
+			logError("encode water ball", err)
+		}
+	}
+}
+
+// printMessages marks highlighted messages with * and puts the tags before the content
+func printMessages(messages []Message) {
+	for i := range messages {
+		m := &messages[i]
+		mark := ""
+		if m.Highlight {
+			mark = "* "
+		}
+		tags := ""
+		if len(m.Tags) > 0 {
+			tags = messageTags(m) + " "
+		}
+		fmt.Printf("%s%s: %s%s %s\n", mark, m.User, tags, m.Message, m.Time.Format("01/02 15:04"))
+	}
+}
+
+func messageTags(m *Message) string {
+	return "[" + strings.Join(m.Tags, "][") + "]"
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"time"
+)
+
+var PromptError = errors.New("PROMPT_FAIL")
+
+// the screen has to stay unchanged this long before a match counts, so a half drawn screen isn't taken
+const settleDelay = 30 * time.Millisecond
+
+// the prompts most flows answer before giving up, enterBoard has its own limit
+const maxPromptAnswers = 20
+
+type Matcher interface {
+	Match(screen *Screen) bool
+}
+
+type MatchFunc func(screen *Screen) bool
+
+func (f MatchFunc) Match(screen *Screen) bool {
+	return f(screen)
+}
+
+func MatchString(s string) Matcher {
+	return MatchFunc(func(screen *Screen) bool {
+		return bytes.Contains(screen.Data, []byte(s))
+	})
+}
+
+func MatchRegexp(re *regexp.Regexp) Matcher {
+	return MatchFunc(func(screen *Screen) bool {
+		return re.Match(screen.Data)
+	})
+}
+
+func MatchCursorLine(s string) Matcher {
+	return MatchFunc(func(screen *Screen) bool {
+		return bytes.Contains(screen.CursorLine(), []byte(s))
+	})
+}
+
+func MatchLine(n int, s string) Matcher {
+	return MatchFunc(func(screen *Screen) bool {
+		return bytes.Contains(screen.Line(n), []byte(s))
+	})
+}
+
+func MatchAny(matchers ...Matcher) Matcher {
+	return MatchFunc(func(screen *Screen) bool {
+		for _, m := range matchers {
+			if m.Match(screen) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func MatchNot(m Matcher) Matcher {
+	return MatchFunc(func(screen *Screen) bool {
+		return !m.Match(screen)
+	})
+}
+
+var matchUpdate = MatchFunc(func(screen *Screen) bool {
+	return true
+})
+
+var matchAnyKey = MatchString("按任意鍵繼續")
+
+// WaitFor blocks until the screen matches or ctx is done, the current screen counts. It only
+// watches the terminal, so it can run next to any operation
+func (ptt *PttClient) WaitFor(ctx context.Context, m Matcher) error {
+	var since uint64
+	for {
+		screen, err := ptt.conn.Wait(ctx, since)
+		if err != nil {
+			return err
+		}
+		if m.Match(&screen) {
+			return nil
+		}
+		since = screen.Version
+	}
+}
+
+// expect waits ptt.timeout for a screen newer than the last seen one that matches
+func (ptt *PttClient) expect(ctx context.Context, m Matcher) error {
+	wait, cancel := context.WithTimeout(ctx, ptt.timeout)
+	defer cancel()
+	return ptt.waitFor(wait, ptt.view.Version, m)
+}
+
+func (ptt *PttClient) waitFor(ctx context.Context, since uint64, m Matcher) error {
+	for {
+		screen, err := ptt.conn.Wait(ctx, since)
+		if err != nil {
+			return err
+		}
+		since = screen.Version
+		ptt.setScreen(ctx, screen)
+		if !m.Match(&ptt.view) {
+			continue
+		}
+
+		settle, cancel := context.WithTimeout(ctx, settleDelay)
+		_, err = ptt.conn.Wait(settle, since)
+		cancel()
+		if err == nil {
+			// still drawing, check the newer screen
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil
+		}
+		return err
+	}
+}
+
+// prompt answers a screen with keys or answer, or stops with err or done
+type prompt struct {
+	matcher Matcher
+	keys    Key
+	answer  func() error
+	err     error
+	done    bool
+}
+
+// answerPrompts answers the first matching prompt and waits until it is gone, until a
+// done or err prompt shows up, each wait is limited by timeout and at most attempts
+// prompts are answered
+func (ptt *PttClient) answerPrompts(ctx context.Context, timeout time.Duration, attempts int, prompts []prompt) error {
+	matchers := make([]Matcher, len(prompts))
+	for i := range prompts {
+		matchers[i] = prompts[i].matcher
+	}
+	since := ptt.view.Version
+	for answers := 0; answers < attempts; answers++ {
+		wait, cancel := context.WithTimeout(ctx, timeout)
+		err := ptt.waitFor(wait, since, MatchAny(matchers...))
+		cancel()
+		if err != nil {
+			return err
+		}
+		ptt.logDebug("prompt----\n%s\n----\n", ptt.screen)
+
+		var p *prompt
+		for i := range prompts {
+			if prompts[i].matcher.Match(&ptt.view) {
+				p = &prompts[i]
+				break
+			}
+		}
+		if p.err != nil {
+			return p.err
+		}
+		if p.done {
+			return nil
+		}
+		if p.answer != nil {
+			err = p.answer()
+		} else {
+			err = ptt.sendKeys(ctx, p.keys)
+		}
+		if err != nil {
+			logError("send prompt answer", err)
+			return err
+		}
+
+		// a prompt still there after timeout is answered again
+		wait, cancel = context.WithTimeout(ctx, timeout)
+		err = ptt.waitFor(wait, ptt.view.Version, MatchNot(p.matcher))
+		cancel()
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+		// the screen without the answered prompt may already show the next one
+		since = ptt.view.Version - 1
+	}
+	return PromptError
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEnterBoardPrompts(t *testing.T) {
+	cases := []struct {
+		name     string
+		over18   bool
+		accept   bool
+		popups   int
+		attempts int
+		err      error
+		view     fakeView
+	}{
+		{name: "popup", popups: 1, attempts: 10, view: fakeBoard},
+		{name: "over18 and popups", over18: true, accept: true, popups: 2, attempts: 10, view: fakeBoard},
+		{name: "over18 rejected", over18: true, popups: 1, attempts: 10, err: BoardOver18Error, view: fakeMainMenu},
+		{name: "too many prompts", popups: 5, attempts: 3, err: EnterBoardError, view: fakePopup},
+	}
+	for _, c := range cases {
+		ptt, fake := newFakeClient(t, 0)
+		fake.over18, fake.popups = c.over18, c.popups
+		ptt.AcceptOver18 = c.accept
+		ptt.enterBoardAttempts = c.attempts
+		// the popups look alike, every answer waits out the timeout
+		ptt.timeout = 200 * time.Millisecond
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+		err := ptt.EnterBoard(ctx, fakeBoardName)
+		cancel()
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: error %v, want %v", c.name, err, c.err)
+		}
+		fake.lock.Lock()
+		view := fake.view
+		fake.lock.Unlock()
+		if view != c.view {
+			t.Errorf("%s: fake on view %d, want %d", c.name, view, c.view)
+		}
+	}
+}
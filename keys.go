@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Key is one keystroke as the bytes a VT100 terminal sends for it
+type Key string
+
+const (
+	KeyEnter     Key = "\r"
+	KeyEsc       Key = "\x1b"
+	KeyBackspace Key = "\b"
+	KeyTab       Key = "\t"
+	KeySpace     Key = " "
+	KeyUp        Key = "\x1b[A"
+	KeyDown      Key = "\x1b[B"
+	KeyRight     Key = "\x1b[C"
+	KeyLeft      Key = "\x1b[D"
+	KeyHome      Key = "\x1b[1~"
+	KeyEnd       Key = "\x1b[4~"
+	KeyPgUp      Key = "\x1b[5~"
+	KeyPgDn      Key = "\x1b[6~"
+)
+
+// PTT reads some keystrokes as one key only when they come in separate writes
+const keyInterval = 20 * time.Millisecond
+
+// Ctrl is the control key combined with a letter, Ctrl('U') is \x15
+func Ctrl(c byte) Key {
+	return Key([]byte{c & 0x1f})
+}
+
+// Text is s typed at once, Big5 text has to be encoded first
+func Text(s string) Key {
+	return Key(s)
+}
+
+// Keys is s typed one character at a time, for prompts that echo every key
+func Keys(s string) []Key {
+	keys := make([]Key, 0, len(s))
+	for _, c := range []byte(s) {
+		keys = append(keys, Key([]byte{c}))
+	}
+	return keys
+}
+
+// Repeat is k pressed n times
+func Repeat(k Key, n int) []Key {
+	keys := make([]Key, n)
+	for i := range keys {
+		keys[i] = k
+	}
+	return keys
+}
+
+// sendKeys writes the keys one by one, keyInterval apart and within ptt.Budget
+func (ptt *PttClient) sendKeys(ctx context.Context, keys ...Key) error {
+	for i, k := range keys {
+		if i > 0 {
+			if err := sleepContext(ctx, keyInterval); err != nil {
+				return err
+			}
+		}
+		if err := ptt.Budget.Wait(ctx); err != nil {
+			return err
+		}
+		if err := ptt.conn.Send(ctx, []byte(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendKeysWait sends the keys and waits ptt.timeout for the screen to change
+func (ptt *PttClient) sendKeysWait(ctx context.Context, keys ...Key) error {
+	since := ptt.view.Version
+	if err := ptt.sendKeys(ctx, keys...); err != nil {
+		return err
+	}
+	wait, cancel := context.WithTimeout(ctx, ptt.timeout)
+	defer cancel()
+	return ptt.waitFor(wait, since, matchUpdate)
+}
@@ -2,140 +2,212 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/joho/godotenv"
+	"io/fs"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 func init() {
-	if err := godotenv.Load(); err != nil {
-		panic(err)
-		return
+	// .env is optional, the flags and the environment are enough without it
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintln(os.Stderr, "load .env:", err)
 	}
 }
 
-func main() {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println("Recovered from ", r)
-		}
-	}()
+const (
+	exitOK = iota
+	exitError
+	exitUsage
+	exitAuth
+	exitNotFound
+	exitOverload
+	exitNotFinishArticle
+)
 
-	PollingMessages(os.Getenv("account"), os.Getenv("password"), false, os.Getenv("board"), os.Getenv("article"))
-	// PushMessage(os.Getenv("account"), os.Getenv("password"), os.Getenv("board"), os.Getenv("article"), "你好ㄚ1c!@#$%^&*()")
-	// TryPushAndPull(os.Getenv("account"), os.Getenv("password"), false, os.Getenv("board"), os.Getenv("article"))
+var usageError = errors.New("USAGE")
+
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, flags *flag.FlagSet, options *cliOptions, args []string) error
 }
 
-func TryPushAndPull(account string, password string, revoke bool, board string, article string) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
-	defer cancel()
+var commands = []command{
+	{"pull", "print the new pushes of the article until interrupted", runPull},
+	{"push", "push a message to the article", runPush},
+	{"chat", "print the new pushes and push every line typed", runChat},
+	{"read", "print the article and its pushes", runRead},
+	{"list", "list the newest articles of the board", runList},
+	{"tally", "count the votes pushed to the article", runTally},
+	{"raffle", "draw winners among the pushes of the article", runRaffle},
+	{"serve", "serve the client over HTTP with JSON", runServe},
+}
 
-	ptt := NewPttClient(ctx)
-	err := ptt.Connect()
-	if err != nil {
-		return
-	}
-	defer ptt.Close()
+// cliOptions are the flags of every command, they default to the environment and .env
+type cliOptions struct {
+	account  string
+	password string
+	board    string
+	article  string
+	revoke   bool
+	over18   bool
+	draft    string
+	debug    bool
+	json     bool
+}
 
-	err = ptt.Login(os.Getenv("account"), os.Getenv("password"), false)
-	if err != nil {
-		if errors.Is(err, AuthError) {
-			fmt.Println("密碼不對或無此帳號")
-		}
-		return
-	}
+func (o *cliOptions) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.account, "account", os.Getenv("account"), "PTT account, $account by default")
+	flags.StringVar(&o.password, "password", os.Getenv("password"), "PTT password, $password by default")
+	flags.StringVar(&o.board, "board", os.Getenv("board"), "board name, $board by default")
+	flags.StringVar(&o.article, "article", os.Getenv("article"), "article AID or URL, $article by default")
+	flags.BoolVar(&o.revoke, "revoke", false, "log out the other sessions of the account")
+	flags.BoolVar(&o.over18, "over18", false, "answer yes when a board asks for age over 18")
+	flags.StringVar(&o.draft, "draft", "", "save or discard an unfinished article PTT asks about")
+	flags.BoolVar(&o.debug, "debug", false, "print the screens")
+	flags.BoolVar(&o.json, "json", false, "print JSON instead of text")
+}
 
-	i := 1
-	go func() {
-		time.Sleep(3 * time.Second)
-		for {
-			err = ptt.PushMessage(strconv.Itoa(i))
-			i += 1
-			if err != nil {
-				fmt.Println(err)
-			}
-			time.Sleep(1 * time.Second)
-		}
-	}()
-
-	go func() {
-		err = ptt.PullMessages(board, article)
-		if err != nil {
-			if errors.Is(err, WrongArticleIdError) {
-				fmt.Println("找不到這個文章代碼(AID)，可能是文章已消失，或是你找錯看板了")
-			}
-			return
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return exitUsage
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
 		}
-	}()
+	}
+	if cmd == nil {
+		usage()
+		return exitUsage
+	}
 
-	for {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	options := &cliOptions{}
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	options.register(flags)
+	err := cmd.run(ctx, flags, options, args[1:])
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		// interrupted by a signal
+		return exitOK
+	}
+	if options.json {
+		json.NewEncoder(os.Stderr).Encode(map[string]string{"error": err.Error()})
+	} else {
+		fmt.Fprintln(os.Stderr, describeError(err))
 	}
+	return exitCode(err)
 }
 
-func PushMessage(account string, password string, board string, article string, message string) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
-	defer cancel()
-
-	ptt := NewPttClient(ctx)
-	err := ptt.Connect()
-	if err != nil {
-		return
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ptt-websocket <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-6s %s\n", cmd.name, cmd.summary)
 	}
-	defer ptt.Close()
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "run ptt-websocket <command> -h for the flags of the command")
+}
 
-	err = ptt.Login(account, password, false)
-	if err != nil {
-		if errors.Is(err, AuthError) {
-			fmt.Println("密碼不對或無此帳號")
-		}
-		return
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, usageError), errors.Is(err, SinkConfigError), errors.Is(err, RuleConfigError):
+		return exitUsage
+	case errors.Is(err, AuthError):
+		return exitAuth
+	case errors.Is(err, WrongArticleIdError), errors.Is(err, InvalidArticleRefError), errors.Is(err, BoardNotFoundError):
+		return exitNotFound
+	case errors.Is(err, PttOverloadError):
+		return exitOverload
+	case errors.Is(err, NotFinishArticleError):
+		return exitNotFinishArticle
 	}
+	return exitError
+}
 
-	err = ptt.PushMessage(message)
-	if err != nil {
-		fmt.Println(err)
+func describeError(err error) string {
+	switch {
+	case errors.Is(err, AuthError):
+		return "密碼不對或無此帳號"
+	case errors.Is(err, NotFinishArticleError):
+		return "有文章尚未完成，請先登入後暫存或捨棄，或以 --draft save 或 --draft discard 處理"
+	case errors.Is(err, PttOverloadError):
+		return "系統過載, 請稍後再來"
+	case errors.Is(err, WrongArticleIdError):
+		return "找不到這個文章代碼(AID)，可能是文章已消失，或是你找錯看板了"
+	case errors.Is(err, InvalidArticleRefError):
+		return "無法辨識的文章代碼或網址"
+	case errors.Is(err, BoardNotFoundError):
+		return "找不到這個看板"
+	case errors.Is(err, BoardNoPermissionError):
+		return "沒有權限進入這個看板"
+	case errors.Is(err, BoardOver18Error):
+		return "這個看板需要年滿十八歲"
+	case errors.Is(err, PushTooFastError):
+		return "推文太快了，請稍等再推"
+	case errors.Is(err, PushForbiddenError):
+		return "這篇文章不能推文"
 	}
+	return err.Error()
 }
 
-func logError(msg string, e error) {
-	fmt.Println(msg, e)
-}
+// login connects and logs in with the options, the connection outlives ctx and login alone
+// is limited to a minute so polling can run until a signal
+func login(ctx context.Context, options *cliOptions) (*PttClient, error) {
+	if options.account == "" || options.password == "" {
+		return nil, fmt.Errorf("%w: account and password are required", usageError)
+	}
+	draft := UnfinishedArticle(options.draft)
+	if draft != RefuseUnfinishedArticle && draft != SaveUnfinishedArticle && draft != DiscardUnfinishedArticle {
+		return nil, fmt.Errorf("%w: --draft takes save or discard", usageError)
+	}
+	ptt := NewPttClient(context.Background())
+	ptt.Debug = options.debug
+	ptt.AcceptOver18 = options.over18
+	ptt.UnfinishedArticle = draft
+	ptt.WaterBallHandler = waterBallPrinter(options)
 
-func PollingMessages(account string, password string, revokeOthers bool, board string, article string) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	loginCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
-
-	ptt := NewPttClient(ctx)
-	err := ptt.Connect()
-	if err != nil {
-		return
+	if err := ptt.Connect(loginCtx); err != nil {
+		return nil, err
 	}
-	defer ptt.Close()
-
-	err = ptt.Login(account, password, revokeOthers)
-	if err != nil {
-		if errors.Is(err, AuthError) {
-			fmt.Println("密碼不對或無此帳號")
-			return
-		} else if errors.Is(err, NotFinishArticleError) {
-			fmt.Println("有文章尚未完成，請先登入後暫存或捨棄再使用 PTT Chat")
-			return
-		} else if errors.Is(err, PttOverloadError) {
-			fmt.Println("系統過載, 請稍後再來")
-			return
-		}
-		return
+	if err := ptt.Login(loginCtx, options.account, options.password, options.revoke); err != nil {
+		ptt.Close()
+		return nil, err
 	}
+	return ptt, nil
+}
 
-	err = ptt.PullMessages(board, article)
-	if err != nil {
-		if errors.Is(err, WrongArticleIdError) {
-			fmt.Println("找不到這個文章代碼(AID)，可能是文章已消失，或是你找錯看板了")
-		}
-		return
+// logout is deferred after every login, whether the command finished, failed or got SIGINT
+// or SIGTERM, so the next run isn't asked to revoke a ghost session
+func logout(ptt *PttClient) {
+	defer ptt.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := ptt.Logout(ctx); err != nil {
+		logError("logout", err)
 	}
 }
+
+func logError(msg string, e error) {
+	fmt.Fprintln(os.Stderr, msg, e)
+}
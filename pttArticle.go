@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Article struct {
+	Board    string    `json:"board"`
+	Aid      string    `json:"aid"`
+	Author   string    `json:"author"`
+	Title    string    `json:"title"`
+	Time     time.Time `json:"time"`
+	Content  string    `json:"content"`
+	Messages []Message `json:"messages"`
+}
+
+// the author line also holds the board: 作者  id (nick)  看板  board
+var articleBoardRegexp = regexp.MustCompile(`\s+看板\s+\S+$`)
+
+// ReadArticle reads the whole article through the pager, pushes after ※ 發信站 go to Messages
+func (ptt *PttClient) ReadArticle(ctx context.Context, board string, article string) (*Article, error) {
+	board, aid, err := resolveArticle(board, article)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ptt.acquire(ctx, "ReadArticle"); err != nil {
+		return nil, err
+	}
+	defer ptt.release()
+
+	if err = ptt.enterBoard(ctx, board); err != nil {
+		return nil, err
+	}
+	if err = ptt.enterArticle(ctx, aid); err != nil {
+		return nil, err
+	}
+	lines, err := ptt.readPager(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := parseArticle(lines)
+	result.Board = board
+	result.Aid = aid
+	return result, nil
+}
+
+func parseArticle(lines []string) *Article {
+	article := &Article{Messages: make([]Message, 0)}
+	body := 0
+	for ; body < len(lines) && body < articleHeaderLines; body++ {
+		m := mailHeaderRegexp.FindStringSubmatch(lines[body])
+		if m == nil {
+			break
+		}
+		switch m[1] {
+		case "作者":
+			article.Author = articleBoardRegexp.ReplaceAllString(m[2], "")
+		case "標題":
+			article.Title = m[2]
+		case "時間":
+			article.Time, _ = time.Parse("Mon Jan _2 15:04:05 2006", m[2])
+		}
+	}
+
+	// the pushes start after the 發信站 line, the body may quote one so take the last
+	end := len(lines)
+	for i := len(lines) - 1; i >= body; i-- {
+		if strings.Contains(lines[i], "※ 發信站:") {
+			end = i + 1
+			break
+		}
+	}
+	article.Content = strings.Trim(strings.Join(lines[body:end], "\n"), "\n")
+
+	var id int32 = 1
+	for i, l := range lines[end:] {
+		message, err := parseMessage([]byte(l), id)
+		if err != nil {
+			continue
+		}
+		message.Line = end + i + 1
+		id++
+		article.Messages = append(article.Messages, *message)
+	}
+	return article
+}
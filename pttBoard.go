@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ArticleEntry struct {
+	Serial    int    `json:"serial"`
+	Aid       string `json:"aid"`
+	Mark      string `json:"mark"`
+	PushCount int    `json:"pushCount"`
+	PushText  string `json:"pushText"`
+	Date      string `json:"date"`
+	Author    string `json:"author"`
+	Category  string `json:"category"`
+	Title     string `json:"title"`
+	Reply     bool   `json:"reply"`
+	Forward   bool   `json:"forward"`
+	Deleted   bool   `json:"deleted"`
+	Locked    bool   `json:"locked"`
+	Pinned    bool   `json:"pinned"`
+}
+
+type ListArticlesOptions struct {
+	// screens to read, starting from the newest one
+	Pages int
+	// query the AID of every entry with Q, one extra round trip per entry
+	ResolveAid bool
+}
+
+var articleEntryRegexp = regexp.MustCompile(`^[>●\s]*(\d+|★)\s+(?:([+~MmSs!=*])\s*)?(?:(爆|XX|X\d|\d{1,2})\s+)?(\d{1,2}/\d{1,2})\s+(\S+)\s+(□|R:|轉)\s*(.*)$`)
+var articleCategoryRegexp = regexp.MustCompile(`^\[([^\]]+)\]`)
+var articleAidRegexp = regexp.MustCompile(`文章代碼\(AID\):\s*(#[0-9A-Za-z\-_]+)`)
+
+func (ptt *PttClient) ListArticles(ctx context.Context, board string, options ListArticlesOptions) ([]ArticleEntry, error) {
+	if options.Pages <= 0 {
+		options.Pages = 1
+	}
+
+	if err := ptt.acquire(ctx, "ListArticles"); err != nil {
+		return nil, err
+	}
+	defer ptt.release()
+
+	err := ptt.enterBoard(ctx, board)
+	if err != nil {
+		return nil, err
+	}
+
+	// jump to the newest article before paging backward
+	if err = ptt.sendKeysWait(ctx, Key("$")); err != nil {
+		logError("send board end", err)
+		return nil, err
+	}
+
+	entries := make(map[int]ArticleEntry)
+	pinned := make([]ArticleEntry, 0)
+	for page := 0; page < options.Pages; page++ {
+		ptt.logDebug("list articles:\n%s\n", ptt.screen)
+		found := 0
+		for _, entry := range parseArticleEntries(ptt.screen) {
+			if entry.Pinned {
+				if page == 0 {
+					pinned = append(pinned, entry)
+				}
+				continue
+			}
+			if _, ok := entries[entry.Serial]; !ok {
+				entries[entry.Serial] = entry
+				found++
+			}
+		}
+		_, reachedFirst := entries[1]
+		if found == 0 || reachedFirst || page == options.Pages-1 {
+			break
+		}
+
+		if err = ptt.sendKeysWait(ctx, KeyPgUp); err != nil {
+			logError("send board page up", err)
+			return nil, err
+		}
+	}
+
+	result := make([]ArticleEntry, 0, len(entries)+len(pinned))
+	for _, entry := range entries {
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Serial < result[j].Serial
+	})
+	result = append(result, pinned...)
+
+	if options.ResolveAid {
+		for i := range result {
+			if result[i].Pinned || result[i].Deleted {
+				continue
+			}
+			result[i].Aid, err = ptt.queryAid(ctx, result[i].Serial)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// move the cursor to the serial number and read the AID from the Q info screen
+func (ptt *PttClient) queryAid(ctx context.Context, serial int) (string, error) {
+	if err := ptt.sendKeysWait(ctx, Text(strconv.Itoa(serial)), KeyEnter); err != nil {
+		logError("send jump to article", err)
+		return "", err
+	}
+	return ptt.queryCurrentAid(ctx)
+}
+
+func (ptt *PttClient) queryCurrentAid(ctx context.Context) (string, error) {
+	err := ptt.sendKeysWait(ctx, Key("Q"))
+	if err != nil {
+		logError("read article info", err)
+		return "", err
+	}
+	ptt.logDebug("article info:\n%s\n", ptt.screen)
+	aid := ""
+	if m := articleAidRegexp.FindSubmatch(ptt.screen); m != nil {
+		aid = string(m[1])
+	}
+
+	if err = ptt.sendKeysWait(ctx, KeySpace); err != nil {
+		logError("send close article info", err)
+		return "", err
+	}
+	return aid, nil
+}
+
+func parseArticleEntries(screen []byte) []ArticleEntry {
+	lines := bytes.Split(screen, []byte("\n"))
+	entries := make([]ArticleEntry, 0, len(lines))
+	for _, l := range lines {
+		entry, ok := parseArticleEntry(string(bytes.TrimRight(l, " ")))
+		if ok {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries
+}
+
+func parseArticleEntry(l string) (*ArticleEntry, bool) {
+	m := articleEntryRegexp.FindStringSubmatch(l)
+	if m == nil {
+		return nil, false
+	}
+
+	entry := &ArticleEntry{
+		Mark:     m[2],
+		PushText: m[3],
+		Date:     m[4],
+		Author:   m[5],
+		Reply:    m[6] == "R:",
+		Forward:  m[6] == "轉",
+		Title:    m[7],
+		Locked:   m[2] == "!",
+	}
+	if m[1] == "★" {
+		entry.Pinned = true
+	} else {
+		entry.Serial, _ = strconv.Atoi(m[1])
+	}
+	entry.PushCount = parsePushCount(m[3])
+	if c := articleCategoryRegexp.FindStringSubmatch(entry.Title); c != nil {
+		entry.Category = strings.TrimSpace(c[1])
+	}
+	// (本文已被刪除) [author] or (已被xxx刪除) <author>
+	if strings.HasPrefix(entry.Title, "(") && strings.Contains(entry.Title, "刪除)") {
+		entry.Deleted = true
+	}
+	return entry, true
+}
+
+// 爆 is 100 or more pushes, XX is -100 or less and Xn is -10n
+func parsePushCount(s string) int {
+	switch {
+	case s == "":
+		return 0
+	case s == "爆":
+		return 100
+	case s == "XX":
+		return -100
+	case strings.HasPrefix(s, "X"):
+		n, _ := strconv.Atoi(s[1:])
+		return -10 * n
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -6,6 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"os"
+	"regexp"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -15,12 +18,33 @@ var AuthError = errors.New("AUTH_FAIL")
 var MsgEncodeError = errors.New("MSG_ENCODE_ERR")
 var NotFinishArticleError = errors.New("NOT_FINISH_ARTICLE")
 var PttOverloadError = errors.New("PTT_OVERLOAD")
+var BoardNotFoundError = errors.New("BOARD_NOT_FOUND")
+var BoardNoPermissionError = errors.New("BOARD_NO_PERMISSION")
+var BoardOver18Error = errors.New("BOARD_OVER18")
+var EnterBoardError = errors.New("ENTER_BOARD_FAIL")
+var MainMenuError = errors.New("MAIN_MENU_FAIL")
+var MenuError = errors.New("MENU_FAIL")
+var PagerError = errors.New("PAGER_FAIL")
+var PushTooFastError = errors.New("PUSH_TOO_FAST")
+var PushForbiddenError = errors.New("PUSH_FORBIDDEN")
+
+const maxPagerPages = 1000
+
+// goodbye screens read after 離開 before giving up on PTT closing the connection
+const maxLogoutScreens = 10
 
 type Message struct {
 	Id      int32     `json:"id"`
 	Time    time.Time `json:"time"`
 	Message string    `json:"message"`
 	User    string    `json:"user"`
+	// 推, 噓 or →
+	Type string `json:"type"`
+	// line in the article, 0 when unknown
+	Line int `json:"line"`
+	// set by the rules of PollOptions
+	Tags      []string `json:"tags,omitempty"`
+	Highlight bool     `json:"highlight,omitempty"`
 }
 
 func (m *Message) Equal(input *Message) bool {
@@ -32,28 +56,51 @@ func (m *Message) Null() bool {
 }
 
 type PttClient struct {
-	ctx          context.Context
-	conn         *PttConnection
-	Cancel       context.CancelFunc
-	lock         sync.Mutex
-	Screen       []byte
-	Debug        bool
-	timeout      time.Duration
-	loginTimeout time.Duration
+	ctx                context.Context
+	conn               *PttConnection
+	Cancel             context.CancelFunc
+	scheduler          *scheduler
+	viewLock           sync.RWMutex
+	screen             []byte
+	view               Screen
+	lastWaterBall      []byte
+	state              PttState
+	Debug              bool
+	AcceptOver18       bool
+	UnfinishedArticle  UnfinishedArticle
+	WaterBallHandler   func(WaterBall)
+	timeout            time.Duration
+	loginTimeout       time.Duration
+	enterBoardAttempts int
+	account            string
+	userCache          map[string]cachedUserProfile
+	userCacheLock      sync.Mutex
+	userCacheTTL       time.Duration
+	board              string
+	article            string
+	articleTitle       []byte
+	Budget             *RequestBudget
 }
 
+// NewPttClient makes a client whose connection lives until context is done, each call
+// takes its own ctx that only bounds that call
 func NewPttClient(context context.Context) *PttClient {
 	return &PttClient{
-		ctx:          context,
-		conn:         NewPttConnection(context),
-		Debug:        false,
-		timeout:      2000 * time.Millisecond,
-		loginTimeout: 30000 * time.Millisecond,
+		ctx:                context,
+		conn:               NewPttConnection(context),
+		scheduler:          newScheduler(),
+		Debug:              false,
+		timeout:            2000 * time.Millisecond,
+		loginTimeout:       30000 * time.Millisecond,
+		enterBoardAttempts: 10,
+		userCache:          make(map[string]cachedUserProfile),
+		userCacheTTL:       10 * time.Minute,
+		Budget:             NewRequestBudget(20, 40),
 	}
 }
 
-func (ptt *PttClient) Connect() (err error) {
-	err = ptt.conn.Connect()
+func (ptt *PttClient) Connect(ctx context.Context) (err error) {
+	err = ptt.conn.Connect(ctx)
 	if err != nil {
 		logError("connect error", err)
 		return err
@@ -65,128 +112,363 @@ func (ptt *PttClient) Close() {
 	ptt.conn.Close()
 }
 
-func (ptt *PttClient) Login(account string, password string, revokeOthers bool) (err error) {
-	for {
-		err = ptt.Read(ptt.loginTimeout)
-		ptt.logDebug("Login----\n%s\n----\n", ptt.Screen)
-		if err != nil {
-			logError("read fail", err)
-			return err
-		}
+// acquire gives the terminal to one operation at a time, every exported operation holds it
+// until it returns so its keys and screens aren't mixed with another one
+func (ptt *PttClient) acquire(ctx context.Context, op string) error {
+	return ptt.scheduler.acquire(ctx, op, priorityUser)
+}
 
-		if bytes.Contains(ptt.Screen, []byte("系統過載, 請稍後再來")) {
-			return PttOverloadError
-		} else if bytes.Contains(ptt.Screen, []byte("密碼不對或無此帳號")) {
-			return AuthError
-		} else if bytes.Contains(ptt.Screen, []byte("請輸入代號")) {
-			accountByte := []byte(account)
-			for i := range accountByte {
-				err = ptt.conn.Send(accountByte[i : i+1])
-				if err != nil {
+// release hands the terminal on, a screen detectState can't tell like the user list leaves
+// the state unknown so the next operation escapes from it
+func (ptt *PttClient) release() {
+	ptt.viewLock.Lock()
+	if detectState(ptt.screen) == StateUnknown {
+		ptt.state = StateUnknown
+	}
+	ptt.viewLock.Unlock()
+	ptt.scheduler.release()
+}
+
+// Screen returns a copy of the last screen an operation saw, safe to call while one runs
+func (ptt *PttClient) Screen() Screen {
+	ptt.viewLock.RLock()
+	defer ptt.viewLock.RUnlock()
+	screen := ptt.view
+	screen.Data = append([]byte(nil), ptt.view.Data...)
+	return screen
+}
+
+// State returns the state of the last screen an operation saw
+func (ptt *PttClient) State() PttState {
+	ptt.viewLock.RLock()
+	defer ptt.viewLock.RUnlock()
+	return ptt.state
+}
+
+func (ptt *PttClient) Login(ctx context.Context, account string, password string, revokeOthers bool) (err error) {
+	if err := ptt.acquire(ctx, "Login"); err != nil {
+		return err
+	}
+	defer ptt.release()
+
+	revoke := Key("N\r")
+	if revokeOthers {
+		revoke = "Y\r"
+	}
+	err = ptt.answerPrompts(ctx, ptt.loginTimeout, maxPromptAnswers, []prompt{
+		{matcher: MatchString("系統過載, 請稍後再來"), err: PttOverloadError},
+		{matcher: MatchString("密碼不對或無此帳號"), err: AuthError},
+		{matcher: MatchCursorLine("請輸入代號"), answer: func() error {
+			// type the account one by one and wait for the echo
+			for i := range account {
+				if err := ptt.sendKeys(ctx, Key(account[i:i+1])); err != nil {
 					logError("send account", err)
 					return err
 				}
-				err = ptt.Read(6000 * time.Millisecond)
-				if err != nil {
+				if err := ptt.expect(ctx, MatchCursorLine(account[:i+1])); err != nil {
 					logError("send account read", err)
 					return err
 				}
 			}
-			err = ptt.conn.Send([]byte("\r"))
-			if err != nil {
-				logError("send account enter", err)
-				return err
-			}
-		} else if bytes.Contains(ptt.Screen, []byte("請輸入您的密碼")) {
-			passwordByte := []byte(password + "\r")
-			for i := range passwordByte {
-				if err = ptt.conn.Send(passwordByte[i : i+1]); err != nil {
-					logError("password send", err)
-					return err
-				}
-			}
-		} else if bytes.Contains(ptt.Screen, []byte("按任意鍵繼續")) {
-			err = ptt.conn.Send([]byte(" "))
-			if err != nil {
-				logError("send continue", err)
-				return err
-			}
-		} else if bytes.Contains(ptt.Screen, []byte("您想刪除其他重複登入的連線嗎")) {
-			revoke := "N"
-			if revokeOthers {
-				revoke = "Y"
-			}
-			err = ptt.conn.Send([]byte(revoke + "\r"))
-			if err != nil {
-				logError("send revoke others", err)
+			return ptt.sendKeys(ctx, KeyEnter)
+		}},
+		{matcher: MatchCursorLine("請輸入您的密碼"), answer: func() error {
+			if err := ptt.sendKeys(ctx, append(Keys(password), KeyEnter)...); err != nil {
+				logError("password send", err)
 				return err
 			}
-		} else if bytes.Contains(ptt.Screen, []byte("您要刪除以上錯誤嘗試的記錄嗎?")) {
-			err = ptt.conn.Send([]byte("n\r"))
-			if err != nil {
-				logError("delete login fails", err)
-				return err
-			}
-		} else if bytes.Contains(ptt.Screen, []byte("您有一篇文章尚未完成")) {
-			return NotFinishArticleError
-		} else if bytes.Contains(ptt.Screen, []byte("您保存信件數目")) || bytes.Contains(ptt.Screen, []byte("郵件選單")) {
-			// 您保存信件數目...超出上限 200, 請整理
-			// need send and read twice
-			err = ptt.conn.Send([]byte("q"))
-			if err != nil {
-				logError("login mail fails", err)
-				return err
+			return nil
+		}},
+		{matcher: matchAnyKey, keys: " "},
+		{matcher: MatchCursorLine("您想刪除其他重複登入的連線嗎"), keys: revoke},
+		{matcher: MatchCursorLine("您要刪除以上錯誤嘗試的記錄嗎?"), keys: "n\r"},
+		ptt.unfinishedArticlePrompt(),
+		// 您保存信件數目...超出上限 200, 請整理
+		{matcher: MatchAny(MatchString("您保存信件數目"), MatchString("郵件選單")), keys: "q"},
+		{matcher: MatchString("主功能表"), done: true},
+	})
+	if err != nil {
+		logError("login fail", err)
+		return err
+	}
+	ptt.account = account
+	ptt.logDebug("login success")
+	return nil
+}
+
+// Logout goes through 離開 of 主功能表 so PTT doesn't keep a ghost session, then closes the connection
+func (ptt *PttClient) Logout(ctx context.Context) error {
+	if err := ptt.acquire(ctx, "Logout"); err != nil {
+		return err
+	}
+	defer ptt.release()
+	defer ptt.Close()
+
+	err := ptt.backToMainMenu(ctx)
+	if err != nil {
+		return err
+	}
+	if err = ptt.selectMenu(ctx, "g", MatchCursorLine("確定要離開")); err != nil {
+		return err
+	}
+	if err = ptt.sendKeys(ctx, Key("y"), KeyEnter); err != nil {
+		logError("send logout confirm", err)
+		return err
+	}
+	// PTT closes the connection after the goodbye screens
+	for attempt := 0; attempt < maxLogoutScreens; attempt++ {
+		if err = ptt.readUpdate(ctx, ptt.timeout); err != nil {
+			return nil
+		}
+		if bytes.Contains(ptt.screen, []byte("按任意鍵繼續")) {
+			if err = ptt.sendKeys(ctx, KeySpace); err != nil {
+				return nil
 			}
-		} else if bytes.Contains(ptt.Screen, []byte("主功能表")) {
-			ptt.logDebug("login success")
-			break
 		}
 	}
 	return nil
 }
 
-func (ptt *PttClient) Read(duration time.Duration) error {
-	var err error
-	ptt.Screen, err = ptt.conn.Read(duration)
-	return err
+// readUpdate waits duration for the next screen update, the screen has to settle before it returns
+func (ptt *PttClient) readUpdate(ctx context.Context, duration time.Duration) error {
+	wait, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	return ptt.waitFor(wait, ptt.view.Version, matchUpdate)
+}
+
+// setScreen is only called by the operation holding the terminal, the lock is for Screen and State
+func (ptt *PttClient) setScreen(ctx context.Context, screen Screen) {
+	ptt.viewLock.Lock()
+	ptt.view = screen
+	waterBalls := ptt.extractWaterBalls()
+	ptt.screen = ptt.view.Data
+	ptt.updateState()
+	ptt.viewLock.Unlock()
+
+	for _, w := range waterBalls {
+		ptt.onWaterBall(w)
+	}
+	if len(waterBalls) > 0 {
+		// Ctrl-L redraws the screen under the water ball
+		if err := ptt.sendKeys(ctx, Ctrl('L')); err != nil {
+			logError("send redraw after water ball", err)
+		}
+	}
+}
+
+type PollOptions struct {
+	// the interval after a poll found new messages, 1s when zero
+	MinInterval time.Duration
+	// the longest interval a quiet article backs off to, 30s when zero
+	MaxInterval time.Duration
+	// the interval is multiplied by this after a poll without new messages, 2 when below 1
+	Backoff float64
+	// gets the new messages of every poll, they are printed when nil, after an error the
+	// checkpoint stays and the same messages come again with the next poll
+	Handler func([]Message) error
+	// resume after the checkpoint of the article and save one after every handled poll
+	Checkpoints *CheckpointStore
+	// read the whole article at start for the messages posted since the checkpoint
+	Backfill bool
+	// drop, tag and highlight messages before the handler, the checkpoint still moves past dropped ones
+	Rules *RuleEngine
+	// start after this message instead of with the last page, like the last one ReadArticle
+	// returned, a checkpoint of the article takes its place
+	After *Message
+}
+
+func (o PollOptions) withDefaults() PollOptions {
+	if o.MinInterval <= 0 {
+		o.MinInterval = time.Second
+	}
+	if o.MaxInterval <= 0 {
+		o.MaxInterval = 30 * time.Second
+	}
+	if o.MaxInterval < o.MinInterval {
+		o.MaxInterval = o.MinInterval
+	}
+	if o.Backoff < 1 {
+		o.Backoff = 2
+	}
+	return o
+}
+
+// next polls fast while messages keep coming and backs off while the article is quiet
+func (o PollOptions) next(interval time.Duration, newMessages int) time.Duration {
+	if newMessages > 0 {
+		return o.MinInterval
+	}
+	interval = time.Duration(float64(interval) * o.Backoff)
+	if interval > o.MaxInterval {
+		return o.MaxInterval
+	}
+	return interval
 }
 
-func (ptt *PttClient) PullMessages(board string, article string) error {
-	var lastMessage *Message
+func (ptt *PttClient) PullMessages(ctx context.Context, board string, article string, options PollOptions) error {
+	board, article, err := resolveArticle(board, article)
+	if err != nil {
+		return err
+	}
+
+	options = options.withDefaults()
+	interval := options.MinInterval
+	lastMessage := options.After
 	var msgId int32 = 1
-	for {
-		ptt.lock.Lock()
-		err := ptt.EnterBoard(board)
+	handler := options.Handler
+	if handler == nil {
+		handler = func(messages []Message) error {
+			for i := 0; i < len(messages); i++ {
+				fmt.Printf("%s: %s %s\n", messages[i].User, messages[i].Message, messages[i].Time)
+			}
+			return nil
+		}
+	}
+	emit := func(messages []Message) error {
+		if len(messages) == 0 {
+			return nil
+		}
+		last := &messages[len(messages)-1]
+		if options.Rules != nil {
+			messages = options.Rules.Apply(messages)
+		}
+		if len(messages) > 0 {
+			if err := handler(messages); err != nil {
+				logError("handle messages", err)
+				return nil
+			}
+		}
+		lastMessage = last
+		if options.Checkpoints != nil {
+			return options.Checkpoints.Save(newCheckpoint(board, article, lastMessage))
+		}
+		return nil
+	}
+
+	if options.Checkpoints != nil {
+		cp, err := options.Checkpoints.Load(board, article)
 		if err != nil {
 			return err
 		}
+		if cp != nil {
+			lastMessage = cp.lastMessage()
+			if options.Backfill {
+				missed, err := ptt.backfill(ctx, board, article, cp)
+				if err != nil {
+					return err
+				}
+				ptt.logDebug("backfill %d messages after line %d\n", len(missed), cp.Line)
+				if err = emit(missed); err != nil {
+					return err
+				}
+			}
+		}
+	}
 
-		err = ptt.EnterArticle(article)
+	for {
+		page, err := ptt.pollArticle(ctx, board, article)
 		if err != nil {
 			return err
 		}
-		err = ptt.pageEnd()
-		if err != nil {
+		var messages []Message
+		if pageSkips(page.Data, lastMessage) {
+			messages, err = ptt.backfill(ctx, board, article, newCheckpoint(board, article, lastMessage))
+			if err != nil {
+				return err
+			}
+			ptt.logDebug("backfill %d messages scrolled above the page\n", len(messages))
+		} else {
+			messages, msgId = parsePageMessages(page.Data, msgId, lastMessage)
+		}
+		if err = emit(messages); err != nil {
 			return err
 		}
 
-		ptt.logDebug("pull message:\n%s\n", ptt.Screen)
-		var messages []Message
-		messages, msgId = ptt.parsePageMessages(msgId, lastMessage)
-		ptt.lock.Unlock()
-		if len(messages) > 0 {
-			lastMessage = &messages[len(messages)-1]
+		interval = options.next(interval, len(messages))
+		ptt.logDebug("next poll in %s\n", interval)
+		if err = sleepContext(ctx, interval); err != nil {
+			return err
 		}
-		for i := 0; i < len(messages); i++ {
-			fmt.Printf("%s: %s %s\n", messages[i].User, messages[i].Message, messages[i].Time)
+	}
+}
+
+// pollArticle returns the last page of the article, it waits behind every user operation
+// and pollers of the same article share one poll
+func (ptt *PttClient) pollArticle(ctx context.Context, board string, article string) (Screen, error) {
+	return ptt.scheduler.coalesce(ctx, "PullMessages", board+"/"+article, func() (Screen, error) {
+		if err := ptt.scheduler.acquire(ctx, "PullMessages", priorityPoll); err != nil {
+			return Screen{}, err
 		}
+		defer ptt.release()
+
+		writes := ptt.conn.Writes()
+		refreshed := false
+		if ptt.board == board && ptt.article == article {
+			var err error
+			if refreshed, err = ptt.refreshArticle(ctx); err != nil {
+				return Screen{}, err
+			}
+		}
+		if !refreshed {
+			if err := ptt.enterBoard(ctx, board); err != nil {
+				return Screen{}, err
+			}
+			if err := ptt.enterArticle(ctx, article); err != nil {
+				return Screen{}, err
+			}
+		}
+		if err := ptt.pageEnd(ctx); err != nil {
+			return Screen{}, err
+		}
+
+		ptt.logDebug("pull message, %d round trips, refreshed %v:\n%s\n", ptt.conn.Writes()-writes, refreshed, ptt.screen)
+		return ptt.Screen(), nil
+	})
+}
 
-		time.Sleep(1 * time.Second)
+// sleepContext sleeps d or returns the ctx error when ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
-func (ptt *PttClient) parsePageMessages(msgId int32, lastMessage *Message) ([]Message, int32) {
-	lines := bytes.Split(ptt.Screen, []byte("\n"))
+// pageSkips tells whether lastMessage is above the page, the pushes between it and the page
+// came in a burst longer than a page and only reading the whole article finds them
+func pageSkips(screen []byte, lastMessage *Message) bool {
+	if lastMessage == nil || lastMessage.Line <= 0 {
+		return false
+	}
+	m := pagerStatusRegexp.FindSubmatch(screen)
+	if m == nil {
+		return false
+	}
+	firstLine, _ := strconv.Atoi(string(m[2]))
+	return lastMessage.Line < firstLine
+}
+
+// parsePageMessages returns the messages of the page after lastMessage, the line numbers are
+// only trusted when lastMessage is still on its line, an edit of the body moves every push
+// so the content and time are compared then
+func parsePageMessages(screen []byte, msgId int32, lastMessage *Message) ([]Message, int32) {
+	lines := bytes.Split(screen, []byte("\n"))
+	// the status bar tells the line of the article on the top row
+	firstLine := 0
+	if m := pagerStatusRegexp.FindSubmatch(screen); m != nil {
+		firstLine, _ = strconv.Atoi(string(m[2]))
+	}
+	trustLines := false
+	if lastMessage != nil && lastMessage.Line > 0 && firstLine > 0 {
+		if i := lastMessage.Line - firstLine; i >= 0 && i < len(lines)-1 {
+			m, err := parseMessage(lines[i], 0)
+			trustLines = err == nil && messageHash(m) == messageHash(lastMessage)
+		}
+	}
 
 	lastLineNum := len(lines) - 2
 	reversedMsgs := make([]Message, 0)
@@ -199,8 +481,17 @@ func (ptt *PttClient) parsePageMessages(msgId int32, lastMessage *Message) ([]Me
 		if err != nil {
 			continue
 		}
-		if lastMessage != nil && (message.Equal(lastMessage) || message.Time.Before(lastMessage.Time)) {
-			break
+		if firstLine > 0 {
+			message.Line = firstLine + i
+		}
+		if lastMessage != nil {
+			if trustLines {
+				if message.Line <= lastMessage.Line {
+					break
+				}
+			} else if message.Equal(lastMessage) || message.Time.Before(lastMessage.Time) {
+				break
+			}
 		}
 		reversedMsgs = append(reversedMsgs, *message)
 	}
@@ -223,70 +514,207 @@ func (ptt *PttClient) parsePageMessages(msgId int32, lastMessage *Message) ([]Me
 	return msgs, msgId
 }
 
-func (ptt *PttClient) pageEnd() error {
-	if bytes.Contains(ptt.Screen, []byte("頁 (100%)  目前顯示")) {
+var pagerStatusRegexp = regexp.MustCompile(`\((\d+)%\)\s+目前顯示: 第 (\d+)~(\d+) 行`)
+var pagerEndRegexp = regexp.MustCompile(`\(100%\)\s+目前顯示`)
+
+// readPager collects every line of the opened article or mail, lines are placed
+// by the range of the status bar so the overlapped last page is not duplicated
+func (ptt *PttClient) readPager(ctx context.Context) ([]string, error) {
+	content := make([]string, 0)
+	for page := 0; ; page++ {
+		m := pagerStatusRegexp.FindSubmatch(ptt.screen)
+		if m == nil {
+			return nil, PagerError
+		}
+		first, _ := strconv.Atoi(string(m[2]))
+		last, _ := strconv.Atoi(string(m[3]))
+		lines := bytes.Split(ptt.screen, []byte("\n"))
+		for i := 0; i < len(lines)-1 && i <= last-first; i++ {
+			n := first + i
+			if n-1 < len(content) {
+				content[n-1] = string(bytes.TrimRight(lines[i], " "))
+			} else if n-1 == len(content) {
+				content = append(content, string(bytes.TrimRight(lines[i], " ")))
+			}
+		}
+		if string(m[1]) == "100" || page >= maxPagerPages {
+			break
+		}
+
+		if err := ptt.sendKeysWait(ctx, KeyPgDn); err != nil {
+			logError("send pager next page", err)
+			return nil, err
+		}
+	}
+	return content, nil
+}
+
+// refreshArticle reopens the article from the board list so the pager loads the new pushes,
+// false when the screen left the article or the cursor moved to another one. The pager keeps
+// the article as it was when opened, so staying in it never shows a new push; Left keeps the
+// cursor on the article and Enter opens it again. With End that is 3 keys a poll instead of
+// the 16 of searching the board and typing the AID again (BenchmarkPollRefresh and
+// BenchmarkPollSearch on the scripted PTT of the tests)
+func (ptt *PttClient) refreshArticle(ctx context.Context) (bool, error) {
+	if ptt.state != StateArticle || ptt.articleTitle == nil {
+		return false, nil
+	}
+	if err := ptt.sendKeys(ctx, KeyLeft); err != nil {
+		logError("send leave article", err)
+		return false, err
+	}
+	if err := ptt.expect(ctx, matchBoard); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return false, nil
+		}
+		logError("read leave article", err)
+		return false, err
+	}
+	if err := ptt.sendKeysWait(ctx, KeyEnter); err != nil {
+		logError("send reopen article", err)
+		return false, err
+	}
+	return ptt.state == StateArticle && bytes.Equal(ptt.view.Line(1), ptt.articleTitle), nil
+}
+
+func (ptt *PttClient) pageEnd(ctx context.Context) error {
+	if pagerEndRegexp.Match(ptt.screen) {
 		return nil
 	}
-	// WORKAROUND: send page end twice to force page end
-	err := ptt.conn.Send([]byte("GG"))
-	if err != nil {
+	if err := ptt.sendKeys(ctx, KeyEnd); err != nil {
 		logError("send article bottom command", err)
 		return err
 	}
-	err = ptt.Read(ptt.timeout)
-	if err != nil {
+	if err := ptt.expect(ctx, MatchRegexp(pagerEndRegexp)); err != nil {
 		logError("read article bottom", err)
 		return err
 	}
 	return nil
 }
 
-func (ptt *PttClient) PushMessage(message string) error {
+var matchPushType = MatchCursorLine("給它噓聲")
+
+// 推 account: with the cursor after the colon
+var matchPushInput = MatchFunc(func(screen *Screen) bool {
+	return pushInputRegexp.Match(screen.CursorLine())
+})
+var pushInputRegexp = regexp.MustCompile(`^(推|噓|→) *[A-Za-z0-9]+ *:`)
+
+// the reasons PTT shows on the status line instead of the push prompt
+var pushRejections = []struct {
+	matcher Matcher
+	err     error
+}{
+	{MatchAny(MatchString("禁止快速連續推文"), MatchString("推文間隔太近")), PushTooFastError},
+	{MatchAny(MatchString("禁止推薦"), MatchString("禁止推文"), MatchString("無法推文"), MatchString("本文已過長")), PushForbiddenError},
+}
+
+var matchPushRejected = MatchFunc(func(screen *Screen) bool {
+	return pushRejection(screen) != nil
+})
+
+func pushRejection(screen *Screen) error {
+	for _, r := range pushRejections {
+		if r.matcher.Match(screen) {
+			return r.err
+		}
+	}
+	return nil
+}
+
+// PushMessage pushes to the article last entered, use PushTo when another operation may
+// enter a different one in between
+func (ptt *PttClient) PushMessage(ctx context.Context, message string) error {
 	big5, err := Utf8ToUaoBig5(message)
 	if err != nil {
 		logError("encode big5 error", err)
 		return MsgEncodeError
 	}
 
-	ptt.lock.Lock()
-	defer ptt.lock.Unlock()
-	if err := ptt.conn.Send([]byte("X")); err != nil {
+	if err := ptt.acquire(ctx, "PushMessage"); err != nil {
+		return err
+	}
+	defer ptt.release()
+	return ptt.pushMessage(ctx, big5)
+}
+
+// PushTo enters the article and pushes while holding the terminal, so no other operation
+// can move it to another article in between, an article already open is not searched again
+func (ptt *PttClient) PushTo(ctx context.Context, board string, article string, message string) error {
+	board, aid, err := resolveArticle(board, article)
+	if err != nil {
+		return err
+	}
+	big5, err := Utf8ToUaoBig5(message)
+	if err != nil {
+		logError("encode big5 error", err)
+		return MsgEncodeError
+	}
+
+	if err := ptt.acquire(ctx, "PushTo"); err != nil {
+		return err
+	}
+	defer ptt.release()
+	if ptt.board != board || ptt.article != aid {
+		if err = ptt.enterBoard(ctx, board); err != nil {
+			return err
+		}
+		if err = ptt.enterArticle(ctx, aid); err != nil {
+			return err
+		}
+	}
+	return ptt.pushMessage(ctx, big5)
+}
+
+func (ptt *PttClient) pushMessage(ctx context.Context, big5 string) (err error) {
+	if err = ptt.goTo(ctx, StateArticle); err != nil {
+		return err
+	}
+	if err = ptt.sendKeys(ctx, Key("X")); err != nil {
 		logError("send push command", err)
 		return err
 	}
-	err = ptt.Read(ptt.timeout)
+	err = ptt.expect(ctx, MatchAny(matchPushType, matchPushInput, matchPushRejected))
 	if err != nil {
 		logError("read push command", err)
 		return err
 	}
+	if rejected := pushRejection(&ptt.view); rejected != nil {
+		if matchAnyKey.Match(&ptt.view) {
+			if err = ptt.sendKeysWait(ctx, KeySpace); err != nil {
+				logError("send dismiss push rejection", err)
+			}
+		}
+		return rejected
+	}
 
-	if bytes.Contains(ptt.Screen, []byte("給它噓聲")) {
-		if err = ptt.conn.Send([]byte("1")); err != nil {
+	if matchPushType.Match(&ptt.view) {
+		if err = ptt.sendKeys(ctx, Key("1")); err != nil {
 			logError("send push command type", err)
 			return err
 		}
-		err = ptt.Read(ptt.timeout)
+		err = ptt.expect(ctx, matchPushInput)
 		if err != nil {
 			logError("read push command", err)
 			return err
 		}
 	}
 
-	if err = ptt.conn.Send([]byte(big5 + "\r")); err != nil {
+	if err = ptt.sendKeys(ctx, Text(big5), KeyEnter); err != nil {
 		logError("send push command type", err)
 		return err
 	}
-	err = ptt.Read(ptt.timeout)
+	err = ptt.expect(ctx, MatchCursorLine("確定"))
 	if err != nil {
 		logError("read push command", err)
 		return err
 	}
 
-	if err = ptt.conn.Send([]byte("Y\r")); err != nil {
+	if err = ptt.sendKeys(ctx, Key("Y"), KeyEnter); err != nil {
 		logError("send push command type", err)
 		return err
 	}
-	err = ptt.Read(ptt.timeout)
+	err = ptt.expect(ctx, MatchRegexp(pagerStatusRegexp))
 	if err != nil {
 		logError("read push command", err)
 		return err
@@ -295,96 +723,175 @@ func (ptt *PttClient) PushMessage(message string) error {
 	return nil
 }
 
-func (ptt *PttClient) EnterArticle(article string) (err error) {
-	articleId := []byte(article + "\r")
-	for i := range articleId {
-		if err = ptt.conn.Send(articleId[i : i+1]); err != nil {
-			logError("send search article", err)
-			return err
-		}
-		err = ptt.Read(ptt.timeout)
-		if err != nil {
-			logError("read search article", err)
-			return err
-		}
+// EnterArticle opens the article of the current board
+func (ptt *PttClient) EnterArticle(ctx context.Context, article string) error {
+	if err := ptt.acquire(ctx, "EnterArticle"); err != nil {
+		return err
 	}
-	if bytes.Contains(ptt.Screen, []byte("找不到這個文章代碼(AID)，可能是文章已消失，或是你找錯看板了")) {
-		return WrongArticleIdError
+	defer ptt.release()
+	return ptt.enterArticle(ctx, article)
+}
+
+func (ptt *PttClient) enterArticle(ctx context.Context, article string) (err error) {
+	if err = ptt.locateArticle(ctx, article); err != nil {
+		return err
 	}
 
-	if err = ptt.conn.Send([]byte("\r")); err != nil {
+	if err = ptt.sendKeysWait(ctx, KeyEnter); err != nil {
 		logError("send article enter command", err)
 		return err
 	}
-	err = ptt.Read(ptt.timeout)
+	ptt.article = article
+	ptt.articleTitle = append([]byte(nil), ptt.view.Line(1)...)
+	return nil
+}
+
+// move the board list cursor to the article without opening it
+func (ptt *PttClient) locateArticle(ctx context.Context, article string) (err error) {
+	_, aid, err := ParseArticleRef(article)
 	if err != nil {
-		logError("read article bottom", err)
 		return err
 	}
+	if err = ptt.sendKeysWait(ctx, append(Keys(aid), KeyEnter)...); err != nil {
+		logError("send search article", err)
+		return err
+	}
+	if bytes.Contains(ptt.screen, []byte("找不到這個文章代碼(AID)，可能是文章已消失，或是你找錯看板了")) {
+		return WrongArticleIdError
+	}
 	return nil
 }
 
-func (ptt *PttClient) EnterBoard(board string) (err error) {
-	searchBoardCmd := []byte("s")
-	err = ptt.conn.Send(searchBoardCmd)
-	if err != nil {
+// the menu hotkey moves the cursor, enter runs the item when the hotkey alone didn't
+func (ptt *PttClient) selectMenu(ctx context.Context, key Key, done Matcher) error {
+	if err := ptt.sendKeysWait(ctx, key); err != nil {
+		logError("send select menu", err)
+		return err
+	}
+	if done.Match(&ptt.view) {
+		return nil
+	}
+
+	if err := ptt.sendKeys(ctx, KeyEnter); err != nil {
+		logError("send select menu enter", err)
+		return err
+	}
+	if err := ptt.expect(ctx, done); err != nil {
+		logError("read select menu enter", err)
+		return MenuError
+	}
+	return nil
+}
+
+var matchBoard = MatchFunc(func(screen *Screen) bool {
+	return bytes.Contains(screen.Data, []byte("【板主:")) && bytes.Contains(screen.Data, []byte("看板《"))
+})
+
+// EnterBoard searches the board with s and goes through the prompts in front of it
+func (ptt *PttClient) EnterBoard(ctx context.Context, board string) error {
+	if err := ptt.acquire(ctx, "EnterBoard"); err != nil {
+		return err
+	}
+	defer ptt.release()
+	return ptt.enterBoard(ctx, board)
+}
+
+// enterBoard escapes to a screen where s searches boards first, whatever the last operation left
+func (ptt *PttClient) enterBoard(ctx context.Context, board string) (err error) {
+	if err = ptt.escape(ctx); err != nil {
+		return err
+	}
+	if err = ptt.sendKeys(ctx, Key("s")); err != nil {
 		logError("send search board command", err)
 		return err
 	}
-	err = ptt.Read(ptt.timeout)
+	err = ptt.expect(ctx, MatchCursorLine("看板"))
 	if err != nil {
 		logError("read search board command", err)
 		return err
 	}
 
-	searchBoard := []byte(board)
-	for i := range searchBoard {
-		if err = ptt.conn.Send(searchBoard[i : i+1]); err != nil {
-			logError("send search board name", err)
-			return err
-		}
-		_, err = ptt.conn.Read(ptt.timeout)
-		if err != nil {
-			logError("read search board name", err)
-			return err
-		}
+	if err = ptt.sendKeys(ctx, Text(board)); err != nil {
+		logError("send search board name", err)
+		return err
+	}
+	err = ptt.expect(ctx, MatchFunc(func(screen *Screen) bool {
+		return bytes.Contains(bytes.ToLower(screen.CursorLine()), bytes.ToLower([]byte(board)))
+	}))
+	if err != nil {
+		logError("read search board name", err)
+		return err
 	}
 
-	if err = ptt.conn.Send([]byte("\r")); err != nil {
+	if err = ptt.sendKeys(ctx, KeyEnter); err != nil {
 		logError("send enter after search board", err)
 		return err
 	}
-	for {
-		err = ptt.Read(ptt.timeout)
-		ptt.logDebug("read after enter board-\n%s\n", ptt.Screen)
-		if err != nil {
-			logError("read after enter board", err)
-			return err
-		}
-		if bytes.Contains(ptt.Screen, []byte("【板主:")) && bytes.Contains(ptt.Screen, []byte("看板《")) &&
-			!bytes.Contains(ptt.Screen, []byte("按任意鍵繼續")) && !bytes.Contains(ptt.Screen, []byte("動畫播放中... 可按 q, Ctrl-C 或其它任意鍵停止")) {
-			break
-		}
-		if err = ptt.conn.Send([]byte(" ")); err != nil {
-			logError("send after enter board", err)
-			return err
+	over18 := prompt{matcher: MatchString("年滿十八歲"), keys: "y\r"}
+	if !ptt.AcceptOver18 {
+		over18.answer = func() error {
+			if err := ptt.sendKeys(ctx, Key("n"), KeyEnter); err != nil {
+				logError("send reject over18", err)
+			}
+			return BoardOver18Error
 		}
 	}
+	err = ptt.answerPrompts(ctx, ptt.timeout, ptt.enterBoardAttempts, []prompt{
+		{matcher: MatchString("動畫播放中... 可按 q, Ctrl-C 或其它任意鍵停止"), keys: " "},
+		{matcher: matchAnyKey, keys: " "},
+		over18,
+		{matcher: MatchAny(MatchString("沒有權限"), MatchString("無法進入"), MatchString("權限不足")), err: BoardNoPermissionError},
+		{matcher: matchBoard, done: true},
+		{matcher: MatchString("主功能表"), err: BoardNotFoundError},
+	})
+	ptt.logDebug("read after enter board-\n%s\n", ptt.screen)
+	if errors.Is(err, context.DeadlineExceeded) && MatchCursorLine("看板名稱").Match(&ptt.view) {
+		return BoardNotFoundError
+	}
+	if errors.Is(err, PromptError) {
+		return EnterBoardError
+	}
+	if err != nil {
+		logError("read after enter board", err)
+		return err
+	}
+
+	// search falls back to the previous board when the name doesn't match
+	if !bytes.Contains(bytes.ToLower(ptt.screen), bytes.ToLower([]byte("看板《"+board+"》"))) {
+		return BoardNotFoundError
+	}
+	ptt.board = board
+	ptt.article = ""
+	ptt.articleTitle = nil
 	return nil
 }
 
+// board can be omitted when the article is an URL
+func resolveArticle(board string, article string) (string, string, error) {
+	refBoard, aid, err := ParseArticleRef(article)
+	if err != nil {
+		return "", "", err
+	}
+	if board == "" {
+		board = refBoard
+	}
+	if board == "" {
+		return "", "", InvalidArticleRefError
+	}
+	return board, aid, nil
+}
+
 func parseMessage(l []byte, i int32) (*Message, error) {
 	var t time.Time
 	var err error
 	if len(l) < 11 || (!bytes.Equal(l[0:4], []byte("推 ")) && !bytes.Equal(l[0:4], []byte("噓 ")) && !bytes.Equal(l[0:4], []byte("→ "))) {
-		fmt.Printf("not message line: %s\n", l)
 		return nil, errors.New("not message line")
 	}
 	date := l[len(l)-11:]
 	t, err = time.Parse("01/02 15:04", string(date))
 	if err != nil {
-		fmt.Printf("parse time error %s \n", err)
-		fmt.Printf("error line: %s\n", l)
+		fmt.Fprintf(os.Stderr, "parse time error %s \n", err)
+		fmt.Fprintf(os.Stderr, "error line: %s\n", l)
 		t = time.Now()
 	}
 
@@ -392,7 +899,6 @@ func parseMessage(l []byte, i int32) (*Message, error) {
 	colon := bytes.Index(l, []byte(":"))
 	user := l[space+1 : colon]
 	if colon+2 > len(l)-11 {
-		fmt.Printf("not message line: %s\n", l)
 		return nil, errors.New("not message line")
 	}
 
@@ -401,11 +907,13 @@ func parseMessage(l []byte, i int32) (*Message, error) {
 		Time:    t,
 		User:    string(bytes.TrimRight(user, " ")),
 		Message: string(bytes.TrimRight(l[colon+2:len(l)-11], " ")),
+		Type:    string(l[0:3]),
 	}, nil
 }
 
+// logDebug writes to stderr so the screens don't end up in the output
 func (ptt *PttClient) logDebug(format string, a ...interface{}) {
 	if ptt.Debug {
-		fmt.Printf(format, a...)
+		fmt.Fprintf(os.Stderr, format, a...)
 	}
 }
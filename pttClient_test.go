@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pushes from several goroutines while PullMessages polls the same article, run with -race
+func TestPushWhilePulling(t *testing.T) {
+	ptt, fake := newFakeClient(t, 5)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var lock sync.Mutex
+	pulled := make(map[string]bool)
+	pulling := make(chan error, 1)
+	go func() {
+		pulling <- ptt.PullMessages(ctx, fakeBoardName, fakeAid, PollOptions{
+			MinInterval: 10 * time.Millisecond,
+			MaxInterval: 50 * time.Millisecond,
+			Handler: func(messages []Message) error {
+				lock.Lock()
+				defer lock.Unlock()
+				for _, m := range messages {
+					pulled[m.Message] = true
+				}
+				return nil
+			},
+		})
+	}()
+
+	// PushMessage pushes to the article last entered
+	if err := ptt.PushTo(ctx, fakeBoardName, fakeAid, "first"); err != nil {
+		t.Fatal(err)
+	}
+	const pushers, pushes = 3, 3
+	errs := make(chan error, (pushers+1)*pushes)
+	var wg sync.WaitGroup
+	for p := 0; p < pushers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < pushes; i++ {
+				errs <- ptt.PushTo(ctx, fakeBoardName, fakeAid, fmt.Sprintf("push %d-%d", p, i))
+			}
+		}(p)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < pushes; i++ {
+			errs <- ptt.PushMessage(ctx, fmt.Sprintf("推文 %d", i))
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pushed := make([]string, 0)
+	for _, m := range fake.Pushes() {
+		if !strings.HasPrefix(m, "old") {
+			pushed = append(pushed, m)
+		}
+	}
+	if len(pushed) != 1+(pushers+1)*pushes {
+		t.Fatalf("pushed %d: %q", len(pushed), pushed)
+	}
+	for deadline := time.Now().Add(10 * time.Second); ; {
+		var missing []string
+		lock.Lock()
+		for _, m := range pushed {
+			if !pulled[m] {
+				missing = append(missing, m)
+			}
+		}
+		lock.Unlock()
+		if len(missing) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("not pulled: %q", missing)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-pulling; !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+}
+
+// the keys a poll sends when it searches the board and types the AID again, like every
+// poll did before refreshArticle
+func BenchmarkPollSearch(b *testing.B) {
+	benchmarkPoll(b, false)
+}
+
+// the keys a poll sends when it reopens the article it is on with refreshArticle
+func BenchmarkPollRefresh(b *testing.B) {
+	benchmarkPoll(b, true)
+}
+
+func benchmarkPoll(b *testing.B, refresh bool) {
+	ptt, fake := newFakeClient(b, 30)
+	ctx := context.Background()
+	if _, err := ptt.pollArticle(ctx, fakeBoardName, fakeAid); err != nil {
+		b.Fatal(err)
+	}
+	writes := fake.Writes()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !refresh {
+			// forget the article so the poll takes the search path
+			ptt.board = ""
+		}
+		if _, err := ptt.pollArticle(ctx, fakeBoardName, fakeAid); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(fake.Writes()-writes)/float64(b.N), "writes/poll")
+}
+
+// a burst longer than a page between two polls is read from the whole article, no push is lost
+func TestPullAfterBurst(t *testing.T) {
+	ptt, fake := newFakeClient(t, 5)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	const burst = 40
+	pulled := make(map[string]int)
+	polls := 0
+	err := ptt.PullMessages(ctx, fakeBoardName, fakeAid, PollOptions{
+		MinInterval: 10 * time.Millisecond,
+		MaxInterval: 10 * time.Millisecond,
+		Handler: func(messages []Message) error {
+			polls++
+			for _, m := range messages {
+				pulled[m.Message]++
+			}
+			if polls == 1 {
+				fake.lock.Lock()
+				for i := 0; i < burst; i++ {
+					fake.push("author", fmt.Sprintf("burst %d", i))
+				}
+				fake.lock.Unlock()
+				return nil
+			}
+			cancel()
+			return nil
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	for i := 0; i < burst; i++ {
+		if n := pulled[fmt.Sprintf("burst %d", i)]; n != 1 {
+			t.Errorf("burst %d pulled %d times", i, n)
+		}
+	}
+}
+
+// WaitFor only watches the terminal, it runs next to an operation without touching its screen
+func TestWaitForWhilePushing(t *testing.T) {
+	ptt, fake := newFakeClient(t, 5)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	never := make(chan error, 1)
+	go func() {
+		never <- ptt.WaitFor(ctx, MatchString("never"))
+	}()
+	pushed := make(chan error, 1)
+	go func() {
+		pushed <- ptt.WaitFor(ctx, MatchString("推 "+fakeAccount+": waited"))
+	}()
+	if err := ptt.PushTo(ctx, fakeBoardName, fakeAid, "waited"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-pushed; err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.Pushes()); n != 6 {
+		t.Fatalf("%d pushes", n)
+	}
+	cancel()
+	if err := <-never; !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+}
+
+// with After the pull starts after the last push read, like tally does after ReadArticle
+func TestPullAfterRead(t *testing.T) {
+	ptt, fake := newFakeClient(t, 5)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	read, err := ptt.ReadArticle(ctx, fakeBoardName, fakeAid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Messages) != 5 {
+		t.Fatalf("read %d pushes", len(read.Messages))
+	}
+	fake.lock.Lock()
+	fake.push("author", "new 0")
+	fake.push("author", "new 1")
+	fake.lock.Unlock()
+
+	var pulled []string
+	err = ptt.PullMessages(ctx, fakeBoardName, fakeAid, PollOptions{
+		MinInterval: 10 * time.Millisecond,
+		After:       &read.Messages[len(read.Messages)-1],
+		Handler: func(messages []Message) error {
+			for _, m := range messages {
+				pulled = append(pulled, m.Message)
+			}
+			cancel()
+			return nil
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	if strings.Join(pulled, ",") != "new 0,new 1" {
+		t.Fatalf("pulled %q", pulled)
+	}
+}
@@ -1,96 +1,132 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"golang.org/x/text/transform"
-	"io"
 	"net/http"
 	"nhooyr.io/websocket"
-	"regexp"
-	"time"
+	"sync"
+	"sync/atomic"
 )
 
-type PttConnection struct {
-	ctx  context.Context
+// transport carries the frames between the terminal and PTT, the websocket or a scripted PTT in tests
+type transport interface {
+	Read(ctx context.Context) ([]byte, error)
+	Write(ctx context.Context, data []byte) error
+	Close() error
+}
+
+type websocketTransport struct {
 	conn *websocket.Conn
 }
 
+func (w websocketTransport) Read(ctx context.Context) ([]byte, error) {
+	_, data, err := w.conn.Read(ctx)
+	return data, err
+}
+
+func (w websocketTransport) Write(ctx context.Context, data []byte) error {
+	return w.conn.Write(ctx, websocket.MessageBinary, data)
+}
+
+func (w websocketTransport) Close() error {
+	return w.conn.Close(websocket.StatusNormalClosure, "")
+}
+
+type PttConnection struct {
+	ctx     context.Context
+	conn    transport
+	lock    sync.Mutex
+	term    *Terminal
+	updated chan struct{}
+	err     error
+	writes  atomic.Uint64
+}
+
 func NewPttConnection(ctx context.Context) *PttConnection {
-	return &PttConnection{ctx: ctx}
+	return &PttConnection{
+		ctx:     ctx,
+		term:    NewTerminal(),
+		updated: make(chan struct{}),
+	}
 }
 
-func (p *PttConnection) Connect() (err error) {
-	p.conn, _, err = websocket.Dial(p.ctx, "wss://ws.ptt.cc/bbs", &websocket.DialOptions{HTTPHeader: http.Header{"Origin": []string{"https://term.ptt.cc"}}})
+// Connect dials with ctx, the connection itself lives until the ctx given to NewPttConnection is done
+func (p *PttConnection) Connect(ctx context.Context) error {
+	conn, _, err := websocket.Dial(ctx, "wss://ws.ptt.cc/bbs", &websocket.DialOptions{HTTPHeader: http.Header{"Origin": []string{"https://term.ptt.cc"}}})
 	if err != nil {
 		return err
 	}
+	p.attach(websocketTransport{conn: conn})
 	return nil
 }
 
-func (p *PttConnection) Close() {
-	p.conn.Close(websocket.StatusInternalError, "")
+// attach starts drawing the frames of conn
+func (p *PttConnection) attach(conn transport) {
+	p.conn = conn
+	go p.readLoop()
 }
 
-func (p *PttConnection) readWithTimeout(duration time.Duration) ([]byte, error) {
-	timeout, cancelFunc := context.WithTimeout(context.Background(), duration)
-	defer cancelFunc()
-	_, data, err := p.conn.Read(timeout)
-	if err != nil {
-		return nil, err
+func (p *PttConnection) Close() {
+	if p.conn == nil {
+		return
 	}
-	return data, nil
+	p.conn.Close()
 }
 
-// keep websocket reading until message size less than 1024
-func (p *PttConnection) Read(duration time.Duration) ([]byte, error) {
-	var all []byte
+// readLoop keeps drawing frames on the terminal and wakes up the waiters until the connection fails
+func (p *PttConnection) readLoop() {
 	for {
-		data, err := p.readWithTimeout(duration)
+		data, err := p.conn.Read(p.ctx)
+		p.lock.Lock()
 		if err != nil {
-			return nil, err
+			p.err = err
+		} else {
+			p.term.Write(data)
 		}
-		all = append(all, data...)
-		if len(data) < 1024 {
-			break
+		close(p.updated)
+		p.updated = make(chan struct{})
+		p.lock.Unlock()
+		if err != nil {
+			return
 		}
 	}
-	reader := transform.NewReader(bytes.NewBuffer(cleanData(all)), NewUaoDecoder())
+}
 
-	utf8, err := io.ReadAll(reader)
-	if err != nil {
-		return nil, err
+// Wait returns the first screen newer than since, or the current screen with the error
+// when ctx is done or the connection fails
+func (p *PttConnection) Wait(ctx context.Context, since uint64) (Screen, error) {
+	for {
+		p.lock.Lock()
+		version, updated, err := p.term.version, p.updated, p.err
+		p.lock.Unlock()
+		if version > since {
+			return p.Snapshot(), nil
+		}
+		if err != nil {
+			return p.Snapshot(), err
+		}
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return p.Snapshot(), ctx.Err()
+		}
 	}
-
-	return utf8, nil
 }
 
-func cleanData(data []byte) []byte {
-	// Replace ANSI escape sequences with =ESC=.
-	data = regexp.MustCompile(`\x1B`).ReplaceAll(data, nil)
-
-	// Remove any remaining ANSI escape codes.
-	data = regexp.MustCompile(`\[[\d+;]*m`).ReplaceAll(data, nil)
-
-	// Replace any [21;2H, [1;3H to change line
-	data = regexp.MustCompile(`\[\d+;[234]H`).ReplaceAll(data, []byte("\n"))
-	data = regexp.MustCompile(`\[[\d;]*H`).ReplaceAll(data, nil)
-
-	// Remove carriage returns.
-	data = bytes.ReplaceAll(data, []byte{'\r'}, nil)
-
-	// Remove backspaces.
-	data = bytes.ReplaceAll(data, []byte{' ', '\x08'}, nil)
-
-	// remove [H [K
-	data = bytes.ReplaceAll(data, []byte("[K"), nil)
-	data = bytes.ReplaceAll(data, []byte("[H"), nil)
+func (p *PttConnection) Snapshot() Screen {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.term.Snapshot()
+}
 
-	return data
+// Writes counts the Send calls, each one is a round trip to PTT
+func (p *PttConnection) Writes() uint64 {
+	return p.writes.Load()
 }
 
-func (p *PttConnection) Send(data []byte) error {
-	err := p.conn.Write(context.Background(), websocket.MessageBinary, data)
+func (p *PttConnection) Send(ctx context.Context, data []byte) error {
+	p.writes.Add(1)
+	err := p.conn.Write(ctx, data)
 	if err != nil {
 		logError("send fail", err)
 		return err
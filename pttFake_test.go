@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/text/transform"
+)
+
+const (
+	fakeBoardName = "Test"
+	fakeAid       = "#1ZxYwVuT"
+	fakeTitle     = "[問卦] 假的文章"
+	fakeAccount   = "tester"
+)
+
+type fakeView int
+
+const (
+	fakeMainMenu fakeView = iota
+	fakeBoardPrompt
+	fakeBoard
+	fakeAidPrompt
+	fakePager
+	fakePushType
+	fakePushInput
+	fakePushConfirm
+	fakeUserList
+	fakeUserSearch
+	fakePopup
+	fakeOver18
+)
+
+// fakePtt is a scripted PTT with the main menu, one board with one article, the pager and
+// the push prompts, every key is answered with the whole screen drawn again
+type fakePtt struct {
+	lock     sync.Mutex
+	frames   chan []byte
+	closed   chan struct{}
+	close    sync.Once
+	writes   atomic.Uint64
+	view     fakeView
+	input    []byte
+	confirm  bool
+	notFound bool
+	// the article, pushes are appended as they come
+	lines []string
+	// first line of the article on the pager, from 1
+	top int
+	now time.Time
+	// ids in the Ctrl-U list, the friends of the account and the user under the cursor
+	online      []string
+	friends     map[string]bool
+	friendsOnly bool
+	userCursor  int
+	// screens shown between the board prompt and the board
+	over18 bool
+	popups int
+	popup  int
+}
+
+func newFakePtt(pushes int) *fakePtt {
+	f := &fakePtt{
+		frames: make(chan []byte, 1024),
+		closed: make(chan struct{}),
+		lines: []string{
+			"作者  author (作者)  看板  " + fakeBoardName,
+			"標題  " + fakeTitle,
+			"時間  Mon Oct 19 10:00:00 2026",
+			"",
+			"內文",
+			"",
+			"--",
+			"※ 發信站: 批踢踢實業坊(ptt.cc), 來自: 127.0.0.1",
+			"※ 文章網址: https://www.ptt.cc/bbs/Test/M.1690000000.A.123.html",
+		},
+		now:     time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC),
+		online:  []string{"alice", "bob", "carol"},
+		friends: map[string]bool{"alice": true},
+	}
+	for i := 0; i < pushes; i++ {
+		f.push("author", fmt.Sprintf("old %d", i))
+	}
+	return f
+}
+
+// newFakeClient is a client on the main menu of a fake PTT with the given pushes
+func newFakeClient(t testing.TB, pushes int) (*PttClient, *fakePtt) {
+	ctx, cancel := context.WithCancel(context.Background())
+	fake := newFakePtt(pushes)
+	ptt := NewPttClient(ctx)
+	ptt.Budget = nil
+	ptt.account = fakeAccount
+	ptt.conn.attach(fake)
+	fake.draw()
+	t.Cleanup(func() {
+		cancel()
+		ptt.Close()
+	})
+	return ptt, fake
+}
+
+func (f *fakePtt) Read(ctx context.Context) ([]byte, error) {
+	select {
+	case data := <-f.frames:
+		return data, nil
+	case <-f.closed:
+		return nil, errors.New("closed")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (f *fakePtt) Write(ctx context.Context, data []byte) error {
+	f.writes.Add(1)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if data[0] == '\x1b' {
+		f.key(string(data))
+	} else {
+		for _, c := range data {
+			f.key(string([]byte{c}))
+		}
+	}
+	f.drawLocked()
+	return nil
+}
+
+func (f *fakePtt) Close() error {
+	f.close.Do(func() { close(f.closed) })
+	return nil
+}
+
+// Writes counts the keys sent to the fake
+func (f *fakePtt) Writes() uint64 {
+	return f.writes.Load()
+}
+
+// Pushes returns the content of the pushes in the article
+func (f *fakePtt) Pushes() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	pushes := make([]string, 0)
+	for _, l := range f.lines {
+		if m, err := parseMessage([]byte(l), 0); err == nil {
+			pushes = append(pushes, m.Message)
+		}
+	}
+	return pushes
+}
+
+func (f *fakePtt) push(user string, message string) {
+	f.now = f.now.Add(time.Minute)
+	f.lines = append(f.lines, fmt.Sprintf("推 %s: %-40s %s", user, message, f.now.Format("01/02 15:04")))
+}
+
+func (f *fakePtt) lastTop() int {
+	return maxInt(1, len(f.lines)-screenRows+2)
+}
+
+func (f *fakePtt) key(k string) {
+	if k == string(Ctrl('L')) {
+		return
+	}
+	f.notFound = false
+	switch f.view {
+	case fakeMainMenu:
+		switch Key(k) {
+		case "s":
+			f.view, f.input = fakeBoardPrompt, nil
+		case Ctrl('U'):
+			f.view, f.userCursor = fakeUserList, 0
+		}
+	case fakeUserList:
+		switch Key(k) {
+		case "f":
+			f.friendsOnly, f.userCursor = !f.friendsOnly, 0
+		case "s":
+			f.view, f.input = fakeUserSearch, nil
+		case KeyLeft:
+			f.view = fakeMainMenu
+		}
+	case fakeUserSearch:
+		if k != string(KeyEnter) {
+			f.input = append(f.input, k...)
+			return
+		}
+		f.view = fakeUserList
+		for i, id := range f.users() {
+			if strings.EqualFold(id, string(f.input)) {
+				f.userCursor = i
+			}
+		}
+	case fakeBoardPrompt:
+		if k != string(KeyEnter) {
+			f.input = append(f.input, k...)
+		} else if strings.EqualFold(string(f.input), fakeBoardName) {
+			f.openBoard(f.over18)
+		} else {
+			f.view = fakeMainMenu
+		}
+	case fakeOver18:
+		switch k {
+		case "y":
+			f.confirm = true
+		case "n":
+			f.confirm = false
+		case string(KeyEnter):
+			if f.confirm {
+				f.openBoard(false)
+			} else {
+				f.view = fakeMainMenu
+			}
+		}
+	case fakePopup:
+		f.popup++
+		if f.popup >= f.popups {
+			f.view = fakeBoard
+		}
+	case fakeBoard:
+		switch Key(k) {
+		case "#":
+			f.view, f.input = fakeAidPrompt, nil
+		case "s":
+			f.view, f.input = fakeBoardPrompt, nil
+		case KeyLeft:
+			f.view = fakeMainMenu
+		case KeyEnter:
+			f.view, f.top = fakePager, 1
+		}
+	case fakeAidPrompt:
+		if k != string(KeyEnter) {
+			f.input = append(f.input, k...)
+			return
+		}
+		f.view = fakeBoard
+		f.notFound = "#"+string(f.input) != fakeAid
+	case fakePager:
+		switch Key(k) {
+		case KeyLeft:
+			f.view = fakeBoard
+		case KeyEnd:
+			f.top = f.lastTop()
+		case KeyPgDn:
+			f.top = minInt(f.top+screenRows-2, f.lastTop())
+		case KeyHome:
+			f.top = 1
+		case "X":
+			f.view = fakePushType
+		}
+	case fakePushType:
+		if k == "1" || k == string(KeyEnter) {
+			f.view, f.input = fakePushInput, nil
+		}
+	case fakePushInput:
+		if k != string(KeyEnter) {
+			f.input = append(f.input, k...)
+			return
+		}
+		f.view, f.confirm = fakePushConfirm, false
+	case fakePushConfirm:
+		if k == "y" || k == "Y" {
+			f.confirm = true
+			return
+		}
+		if k == string(KeyEnter) {
+			if f.confirm {
+				message, _, _ := transform.Bytes(NewUaoDecoder(), f.input)
+				f.push(fakeAccount, string(message))
+			}
+			f.view, f.top = fakePager, f.lastTop()
+		}
+	}
+}
+
+// openBoard goes through the over18 question and the popups before the board
+func (f *fakePtt) openBoard(over18 bool) {
+	switch {
+	case over18:
+		f.view, f.confirm = fakeOver18, false
+	case f.popups > 0:
+		f.view, f.popup = fakePopup, 0
+	default:
+		f.view = fakeBoard
+	}
+}
+
+// users are the ids the Ctrl-U list shows
+func (f *fakePtt) users() []string {
+	if !f.friendsOnly {
+		return f.online
+	}
+	users := make([]string, 0)
+	for _, id := range f.online {
+		if f.friends[id] {
+			users = append(users, id)
+		}
+	}
+	return users
+}
+
+func (f *fakePtt) draw() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.drawLocked()
+}
+
+// drawLocked sends the whole screen and puts the cursor where PTT has it
+func (f *fakePtt) drawLocked() {
+	rows := make([]string, screenRows)
+	cursor := screenRows - 1
+	switch f.view {
+	case fakeMainMenu, fakeBoardPrompt:
+		rows[0] = "【主功能表】                        批踢踢實業坊"
+		rows[3] = "      (C)lass      【 分組討論區 】"
+		cursor = 3
+		if f.view == fakeBoardPrompt {
+			rows[1] = "請輸入看板名稱(按空白鍵自動搜尋)：" + string(f.input)
+			cursor = 1
+		}
+	case fakeBoard, fakeAidPrompt:
+		rows[0] = "【板主:sysop】                    看板《" + fakeBoardName + "》"
+		rows[2] = "   編號    日 期 作  者       文  章  標  題"
+		rows[3] = "●     1 10/19 author       □ " + fakeTitle
+		cursor = 3
+		switch {
+		case f.view == fakeAidPrompt:
+			rows[screenRows-1] = "搜尋文章代碼(AID): #" + string(f.input)
+			cursor = screenRows - 1
+		case f.notFound:
+			rows[screenRows-1] = "找不到這個文章代碼(AID)，可能是文章已消失，或是你找錯看板了"
+		default:
+			rows[screenRows-1] = "文章選讀  (y)回應 (X)推文 (^X)轉錄"
+		}
+	case fakeOver18:
+		rows[10] = "本看板內容需年滿十八歲方可瀏覽"
+		rows[12] = "您年滿十八歲了嗎？ [y/N]:"
+		cursor = 12
+	case fakePopup:
+		rows[0] = fmt.Sprintf("進板畫面 %d/%d", f.popup+1, f.popups)
+		rows[screenRows-1] = "請按任意鍵繼續"
+	case fakeUserList, fakeUserSearch:
+		rows[0] = "【休閒聊天】"
+		if f.friendsOnly {
+			rows[0] = "【好友列表】"
+		}
+		rows[2] = "  編號  代號          暱稱              故鄉              動態"
+		for i, id := range f.users() {
+			mark := " "
+			if i == f.userCursor {
+				mark, cursor = ">", 3+i
+			}
+			rows[3+i] = fmt.Sprintf("%s%5d  %-12s  %-16s  %-16s  閒晃", mark, i+1, id, id+" nick", "127.0.0.1")
+		}
+		if f.view == fakeUserSearch {
+			rows[screenRows-1] = "請輸入使用者代號：" + string(f.input)
+			cursor = screenRows - 1
+		}
+	default:
+		last := minInt(f.top+screenRows-2, len(f.lines))
+		copy(rows, f.lines[f.top-1:last])
+		percent := 100
+		if last < len(f.lines) {
+			percent = last * 100 / len(f.lines)
+		}
+		rows[screenRows-1] = fmt.Sprintf("  瀏覽 第 1/1 頁 (%d%%)  目前顯示: 第 %d~%d 行", percent, f.top, last)
+		switch f.view {
+		case fakePushType:
+			rows[screenRows-1] = "您覺得這篇文章 1.值得推薦 2.給它噓聲 3.只加→註解 [1]? "
+		case fakePushInput:
+			message, _, _ := transform.Bytes(NewUaoDecoder(), f.input)
+			rows[screenRows-1] = "推 " + fakeAccount + ":" + string(message)
+		case fakePushConfirm:
+			rows[screenRows-1] = "確定[y/N]:"
+		}
+	}
+
+	var frame strings.Builder
+	frame.WriteString("\x1b[H\x1b[2J")
+	for i, row := range rows {
+		if i > 0 {
+			frame.WriteString("\r\n")
+		}
+		big5, err := Utf8ToUaoBig5(row)
+		if err != nil {
+			panic(err)
+		}
+		frame.WriteString(big5)
+	}
+	fmt.Fprintf(&frame, "\x1b[%d;1H", cursor+1)
+	f.frames <- []byte(frame.String())
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var UserNotFoundError = errors.New("USER_NOT_FOUND")
+var MailError = errors.New("MAIL_FAIL")
+
+type MailEntry struct {
+	Serial int    `json:"serial"`
+	Mark   string `json:"mark"`
+	Date   string `json:"date"`
+	Author string `json:"author"`
+	Title  string `json:"title"`
+}
+
+type Mail struct {
+	Serial  int       `json:"serial"`
+	Author  string    `json:"author"`
+	Title   string    `json:"title"`
+	Time    time.Time `json:"time"`
+	Content string    `json:"content"`
+}
+
+var mailEntryRegexp = regexp.MustCompile(`^[>●\s]*(\d+)\s+(?:([+~MmSs!=*X])\s*)?(\d{1,2}/\d{1,2})\s+(\S+)\s+(.*)$`)
+var mailHeaderRegexp = regexp.MustCompile(`^\s*(作者|標題|時間)\s+(.*?)\s*$`)
+
+var matchMailMenu = MatchString("郵件選單")
+var matchMailList = MatchString("編號")
+
+func (ptt *PttClient) ListMails(ctx context.Context) ([]MailEntry, error) {
+	if err := ptt.acquire(ctx, "ListMails"); err != nil {
+		return nil, err
+	}
+	defer ptt.release()
+
+	err := ptt.enterMailList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[int]MailEntry)
+	for page := 0; page < maxPagerPages; page++ {
+		found := 0
+		for _, entry := range parseMailEntries(ptt.screen) {
+			if _, ok := entries[entry.Serial]; !ok {
+				entries[entry.Serial] = entry
+				found++
+			}
+		}
+		if _, reachedFirst := entries[1]; found == 0 || reachedFirst {
+			break
+		}
+
+		if err = ptt.sendKeysWait(ctx, KeyPgUp); err != nil {
+			logError("send mail page up", err)
+			return nil, err
+		}
+	}
+
+	result := make([]MailEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Serial < result[j].Serial
+	})
+	return result, nil
+}
+
+func (ptt *PttClient) ReadMail(ctx context.Context, serial int) (*Mail, error) {
+	if err := ptt.acquire(ctx, "ReadMail"); err != nil {
+		return nil, err
+	}
+	defer ptt.release()
+
+	err := ptt.enterMailList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// jump to the mail and open it
+	if err = ptt.sendKeysWait(ctx, Text(strconv.Itoa(serial)), KeyEnter, KeyEnter); err != nil {
+		logError("send read mail", err)
+		return nil, err
+	}
+
+	lines, err := ptt.readPager(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mail := parseMail(lines)
+	mail.Serial = serial
+
+	if err = ptt.sendKeysWait(ctx, Key("q")); err != nil {
+		logError("send leave mail", err)
+		return nil, err
+	}
+	return mail, nil
+}
+
+func (ptt *PttClient) SendMail(ctx context.Context, to string, subject string, body string) error {
+	big5Subject, err := Utf8ToUaoBig5(subject)
+	if err != nil {
+		logError("encode mail subject error", err)
+		return MsgEncodeError
+	}
+
+	if err := ptt.acquire(ctx, "SendMail"); err != nil {
+		return err
+	}
+	defer ptt.release()
+
+	if err = ptt.enterMailMenu(ctx); err != nil {
+		return err
+	}
+	if err = ptt.selectMenu(ctx, "s", MatchCursorLine("收信人")); err != nil {
+		return err
+	}
+
+	if err = ptt.sendKeysWait(ctx, Text(to), KeyEnter); err != nil {
+		logError("send mail receiver", err)
+		return err
+	}
+	if !bytes.Contains(ptt.screen, []byte("主題")) {
+		return UserNotFoundError
+	}
+
+	if err = ptt.sendKeysWait(ctx, Text(big5Subject), KeyEnter); err != nil {
+		logError("send mail subject", err)
+		return err
+	}
+
+	if err = ptt.typeEditorText(ctx, body); err != nil {
+		return err
+	}
+	return ptt.saveEditor(ctx, matchMailMenu)
+}
+
+func (ptt *PttClient) DeleteMail(ctx context.Context, serial int) error {
+	if err := ptt.acquire(ctx, "DeleteMail"); err != nil {
+		return err
+	}
+	defer ptt.release()
+
+	err := ptt.enterMailList(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = ptt.sendKeysWait(ctx, Text(strconv.Itoa(serial)), KeyEnter, Key("d")); err != nil {
+		logError("send delete mail", err)
+		return err
+	}
+	return ptt.confirmDeleteMail(ctx)
+}
+
+// PruneMails deletes the oldest mails and keeps the newest keep mails, marked mails are kept by PTT
+func (ptt *PttClient) PruneMails(ctx context.Context, keep int) error {
+	if err := ptt.acquire(ctx, "PruneMails"); err != nil {
+		return err
+	}
+	defer ptt.release()
+
+	err := ptt.enterMailList(ctx)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, entry := range parseMailEntries(ptt.screen) {
+		if entry.Serial > total {
+			total = entry.Serial
+		}
+	}
+	if total <= keep {
+		return nil
+	}
+
+	// D deletes a range, asks for the first and the last mail
+	if err = ptt.sendKeysWait(ctx, Key("D")); err != nil {
+		logError("send delete mail range", err)
+		return err
+	}
+	if !bytes.Contains(ptt.screen, []byte("首篇")) {
+		return MailError
+	}
+	if err = ptt.sendKeysWait(ctx, Key("1"), KeyEnter); err != nil {
+		logError("send delete mail first", err)
+		return err
+	}
+	if err = ptt.sendKeysWait(ctx, Text(strconv.Itoa(total-keep)), KeyEnter); err != nil {
+		logError("send delete mail last", err)
+		return err
+	}
+	return ptt.confirmDeleteMail(ctx)
+}
+
+func (ptt *PttClient) confirmDeleteMail(ctx context.Context) error {
+	if !bytes.Contains(ptt.screen, []byte("刪除")) {
+		return MailError
+	}
+	if err := ptt.sendKeysWait(ctx, Key("y"), KeyEnter); err != nil {
+		logError("send confirm delete mail", err)
+		return err
+	}
+	return nil
+}
+
+func (ptt *PttClient) enterMailMenu(ctx context.Context) error {
+	if err := ptt.backToMainMenu(ctx); err != nil {
+		return err
+	}
+	return ptt.selectMenu(ctx, "m", matchMailMenu)
+}
+
+// mail list ends at the newest mail
+func (ptt *PttClient) enterMailList(ctx context.Context) error {
+	if err := ptt.enterMailMenu(ctx); err != nil {
+		return err
+	}
+	if err := ptt.selectMenu(ctx, "r", matchMailList); err != nil {
+		return err
+	}
+	if err := ptt.sendKeysWait(ctx, Key("$")); err != nil {
+		logError("send mail list end", err)
+		return err
+	}
+	return nil
+}
+
+func parseMailEntries(screen []byte) []MailEntry {
+	lines := bytes.Split(screen, []byte("\n"))
+	entries := make([]MailEntry, 0, len(lines))
+	for _, l := range lines {
+		m := mailEntryRegexp.FindStringSubmatch(string(bytes.TrimRight(l, " ")))
+		if m == nil {
+			continue
+		}
+		serial, _ := strconv.Atoi(m[1])
+		entries = append(entries, MailEntry{
+			Serial: serial,
+			Mark:   m[2],
+			Date:   m[3],
+			Author: m[4],
+			Title:  strings.TrimLeft(m[5], "□◇ "),
+		})
+	}
+	return entries
+}
+
+func parseMail(lines []string) *Mail {
+	mail := &Mail{}
+	body := 0
+	for ; body < len(lines) && body < articleHeaderLines; body++ {
+		m := mailHeaderRegexp.FindStringSubmatch(lines[body])
+		if m == nil {
+			break
+		}
+		switch m[1] {
+		case "作者":
+			mail.Author = m[2]
+		case "標題":
+			mail.Title = m[2]
+		case "時間":
+			mail.Time, _ = time.Parse("Mon Jan _2 15:04:05 2006", m[2])
+		}
+	}
+	mail.Content = strings.TrimLeft(strings.Join(lines[body:], "\n"), "\n")
+	return mail
+}
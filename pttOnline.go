@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var InvalidIntervalError = errors.New("INVALID_INTERVAL")
+
+type OnlineUser struct {
+	Serial   int    `json:"serial"`
+	Id       string `json:"id"`
+	Nickname string `json:"nickname"`
+	Origin   string `json:"origin"`
+	Activity string `json:"activity"`
+}
+
+type PresenceEvent struct {
+	Id     string      `json:"id"`
+	Online bool        `json:"online"`
+	User   *OnlineUser `json:"user,omitempty"`
+	Time   time.Time   `json:"time"`
+}
+
+// serial, friend mark, id, nickname, origin and activity separated by at least two spaces
+var onlineUserRegexp = regexp.MustCompile(`^[>●\s]*(\d+)\s+[*!+:]?\s*([A-Za-z][A-Za-z0-9]{1,11})\s+(.+?)\s{2,}(\S+)\s{2,}(\S+)`)
+
+// ListOnlineUsers reads the Ctrl-U list, friendsOnly switches to the friend list with f
+func (ptt *PttClient) ListOnlineUsers(ctx context.Context, friendsOnly bool, maxPages int) ([]OnlineUser, error) {
+	return ptt.listOnlineUsers(ctx, "ListOnlineUsers", priorityUser, friendsOnly, maxPages)
+}
+
+func (ptt *PttClient) listOnlineUsers(ctx context.Context, op string, priority opPriority, friendsOnly bool, maxPages int) ([]OnlineUser, error) {
+	if maxPages <= 0 {
+		maxPages = 1
+	}
+
+	if err := ptt.scheduler.acquire(ctx, op, priority); err != nil {
+		return nil, err
+	}
+	defer ptt.release()
+
+	err := ptt.showUserList(ctx, friendsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]OnlineUser, 0)
+	seen := make(map[int]bool)
+	for page := 0; page < maxPages; page++ {
+		found := 0
+		for _, user := range parseOnlineUsers(ptt.screen) {
+			if !seen[user.Serial] {
+				seen[user.Serial] = true
+				users = append(users, user)
+				found++
+			}
+		}
+		if found == 0 || page == maxPages-1 {
+			break
+		}
+
+		if err = ptt.sendKeysWait(ctx, KeyPgDn); err != nil {
+			logError("send user list page down", err)
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+// showUserList opens the Ctrl-U list, the friend list with friendsOnly, f switches between them
+func (ptt *PttClient) showUserList(ctx context.Context, friendsOnly bool) error {
+	if err := ptt.enterUserList(ctx); err != nil {
+		return err
+	}
+	if bytes.Contains(ptt.screen, []byte("好友列表")) != friendsOnly {
+		if err := ptt.sendKeysWait(ctx, Key("f")); err != nil {
+			logError("send toggle friend list", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// WatchUsers looks ids up in the whole online list every interval and calls handler when one
+// of them comes online or leaves, the ids don't have to be friends of the account
+func (ptt *PttClient) WatchUsers(ctx context.Context, ids []string, interval time.Duration, handler func(PresenceEvent)) error {
+	if interval <= 0 {
+		return InvalidIntervalError
+	}
+
+	online := make(map[string]*OnlineUser)
+	for {
+		current, err := ptt.findOnlineUsers(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, id := range ids {
+			key := strings.ToLower(id)
+			user, on := current[key]
+			_, was := online[key]
+			if on && !was {
+				handler(PresenceEvent{Id: user.Id, Online: true, User: user, Time: now})
+			} else if !on && was {
+				handler(PresenceEvent{Id: online[key].Id, Online: false, Time: now})
+			}
+		}
+		online = current
+
+		if err = sleepContext(ctx, interval); err != nil {
+			return err
+		}
+	}
+}
+
+// findOnlineUsers searches every id in the whole online list with s, the cursor moves to the
+// user when it is online, the users found are returned by lower case id
+func (ptt *PttClient) findOnlineUsers(ctx context.Context, ids []string) (map[string]*OnlineUser, error) {
+	if err := ptt.scheduler.acquire(ctx, "WatchUsers", priorityPoll); err != nil {
+		return nil, err
+	}
+	defer ptt.release()
+
+	if err := ptt.showUserList(ctx, false); err != nil {
+		return nil, err
+	}
+	found := make(map[string]*OnlineUser)
+	for _, id := range ids {
+		err := ptt.locateOnlineUser(ctx, id)
+		if errors.Is(err, UserOfflineError) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range parseOnlineUsers(ptt.view.CursorLine()) {
+			if strings.EqualFold(user.Id, id) {
+				user := user
+				found[strings.ToLower(id)] = &user
+			}
+		}
+	}
+	return found, nil
+}
+
+func parseOnlineUsers(screen []byte) []OnlineUser {
+	lines := bytes.Split(screen, []byte("\n"))
+	users := make([]OnlineUser, 0, len(lines))
+	for _, l := range lines {
+		m := onlineUserRegexp.FindStringSubmatch(string(bytes.TrimRight(l, " ")))
+		if m == nil {
+			continue
+		}
+		serial, _ := strconv.Atoi(m[1])
+		users = append(users, OnlineUser{
+			Serial:   serial,
+			Id:       m[2],
+			Nickname: m[3],
+			Origin:   m[4],
+			Activity: m[5],
+		})
+	}
+	return users
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// watched ids don't have to be friends, they are searched in the whole online list
+func TestWatchUsers(t *testing.T) {
+	ptt, fake := newFakeClient(t, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var events []string
+	err := ptt.WatchUsers(ctx, []string{"Bob", "dave", "alice"}, 10*time.Millisecond, func(e PresenceEvent) {
+		events = append(events, fmt.Sprintf("%s %v", e.Id, e.Online))
+		if e.Online && e.Id == "bob" {
+			fake.lock.Lock()
+			fake.online = []string{"alice", "carol"}
+			fake.lock.Unlock()
+		}
+		if !e.Online {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	if got := strings.Join(events, ","); got != "bob true,alice true,bob false" {
+		t.Fatalf("events %q", got)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var NoPostPermissionError = errors.New("NO_POST_PERMISSION")
+var EditorError = errors.New("EDITOR_FAIL")
+var ArticleNoPermissionError = errors.New("ARTICLE_NO_PERMISSION")
+var NewArticleNotFoundError = errors.New("NEW_ARTICLE_NOT_FOUND")
+
+var matchEditor = MatchString("編輯文章")
+
+// lines of 作者, 標題, 時間 and the blank line before the body
+const articleHeaderLines = 4
+const maxEditorLines = 1000
+
+var postCategoryRegexp = regexp.MustCompile(`(\d+)\.\s*([^\s\d.]+)`)
+
+// UnfinishedArticle is what to do with the article PTT kept from a session that broke in the editor
+type UnfinishedArticle string
+
+const (
+	// RefuseUnfinishedArticle stops with NotFinishArticleError and leaves the article to the user
+	RefuseUnfinishedArticle UnfinishedArticle = ""
+	// SaveUnfinishedArticle writes it to a draft (暫存檔)
+	SaveUnfinishedArticle UnfinishedArticle = "save"
+	// DiscardUnfinishedArticle drops it
+	DiscardUnfinishedArticle UnfinishedArticle = "discard"
+)
+
+// unfinishedArticlePrompt answers 您有一篇文章尚未完成，(S)寫入暫存檔 (Q)算了 as UnfinishedArticle says
+func (ptt *PttClient) unfinishedArticlePrompt() prompt {
+	matcher := MatchString("您有一篇文章尚未完成")
+	switch ptt.UnfinishedArticle {
+	case SaveUnfinishedArticle:
+		return prompt{matcher: matcher, keys: "s\r"}
+	case DiscardUnfinishedArticle:
+		return prompt{matcher: matcher, keys: "q\r"}
+	}
+	return prompt{matcher: matcher, err: NotFinishArticleError}
+}
+
+// PostArticle posts to the board and returns the AID of the new article, an article left
+// unfinished by an earlier session fails with NotFinishArticleError unless UnfinishedArticle
+// says to save or discard it
+func (ptt *PttClient) PostArticle(ctx context.Context, board string, category string, title string, body string) (string, error) {
+	big5Title, err := Utf8ToUaoBig5(title)
+	if err != nil {
+		logError("encode title error", err)
+		return "", MsgEncodeError
+	}
+
+	if err := ptt.acquire(ctx, "PostArticle"); err != nil {
+		return "", err
+	}
+	defer ptt.release()
+
+	err = ptt.enterBoard(ctx, board)
+	if err != nil {
+		return "", err
+	}
+
+	if err = ptt.sendKeys(ctx, Ctrl('P')); err != nil {
+		logError("send post command", err)
+		return "", err
+	}
+	err = ptt.answerPrompts(ctx, ptt.timeout, maxPromptAnswers, []prompt{
+		{matcher: matchEditor, done: true},
+		ptt.unfinishedArticlePrompt(),
+		{matcher: MatchAny(MatchString("沒有發表文章的權限"), MatchString("無法發文"), MatchString("禁止發文")), err: NoPostPermissionError},
+		{matcher: MatchCursorLine("標題："), keys: Text(big5Title) + KeyEnter},
+		{matcher: MatchCursorLine("類別"), answer: func() error {
+			return ptt.sendKeys(ctx, Text(postCategoryOption(ptt.screen, category)), KeyEnter)
+		}},
+		{matcher: matchAnyKey, keys: " "},
+	})
+	if err != nil {
+		logError("read post command", err)
+		return "", err
+	}
+
+	if err = ptt.typeEditorText(ctx, body); err != nil {
+		return "", err
+	}
+	if err = ptt.saveEditor(ctx, matchBoard); err != nil {
+		return "", err
+	}
+
+	fullTitle := title
+	if category != "" {
+		fullTitle = "[" + category + "] " + title
+	}
+	return ptt.queryNewArticleAid(ctx, func(entry *ArticleEntry) bool {
+		return !entry.Reply && sameTitle(entry.Title, fullTitle)
+	})
+}
+
+// EditArticle replaces the body between the header and the -- signature line
+func (ptt *PttClient) EditArticle(ctx context.Context, board string, aid string, newBody string) error {
+	if err := ptt.acquire(ctx, "EditArticle"); err != nil {
+		return err
+	}
+	defer ptt.release()
+
+	err := ptt.enterBoard(ctx, board)
+	if err != nil {
+		return err
+	}
+	if err = ptt.locateArticle(ctx, aid); err != nil {
+		return err
+	}
+
+	if err = ptt.sendKeys(ctx, Key("E")); err != nil {
+		logError("send edit command", err)
+		return err
+	}
+	if err = ptt.expect(ctx, matchEditor); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return ArticleNoPermissionError
+		}
+		logError("read edit command", err)
+		return err
+	}
+
+	// Ctrl-S moves to the head of file, then skip the header
+	if err = ptt.sendKeysWait(ctx, append([]Key{Ctrl('S')}, Repeat(KeyDown, articleHeaderLines)...)...); err != nil {
+		logError("send editor head", err)
+		return err
+	}
+
+	// Ctrl-Y deletes the current line and pulls up the next one
+	for i := 0; ; i++ {
+		if i >= maxEditorLines {
+			return EditorError
+		}
+		if bytes.HasPrefix(bytes.TrimLeft(ptt.view.CursorLine(), " "), []byte("--")) {
+			break
+		}
+		if err = ptt.sendKeysWait(ctx, Ctrl('Y')); err != nil {
+			logError("send editor delete line", err)
+			return err
+		}
+	}
+
+	if err = ptt.typeEditorText(ctx, newBody+"\n"); err != nil {
+		return err
+	}
+	return ptt.saveEditor(ctx, matchBoard)
+}
+
+// ReplyArticle posts a reply to the board, or to both the board and the author's mailbox
+func (ptt *PttClient) ReplyArticle(ctx context.Context, board string, aid string, body string, toMailAlso bool) (string, error) {
+	if err := ptt.acquire(ctx, "ReplyArticle"); err != nil {
+		return "", err
+	}
+	defer ptt.release()
+
+	err := ptt.enterBoard(ctx, board)
+	if err != nil {
+		return "", err
+	}
+	if err = ptt.locateArticle(ctx, aid); err != nil {
+		return "", err
+	}
+	// the reply keeps the title, the entry under the cursor tells it
+	original, _ := parseArticleEntry(string(bytes.TrimRight(ptt.view.CursorLine(), " ")))
+
+	if err = ptt.sendKeys(ctx, Key("y")); err != nil {
+		logError("send reply command", err)
+		return "", err
+	}
+	target := Key("F\r")
+	if toMailAlso {
+		target = "B\r"
+	}
+	err = ptt.answerPrompts(ctx, ptt.timeout, maxPromptAnswers, []prompt{
+		{matcher: matchEditor, done: true},
+		{matcher: MatchAny(MatchString("無法回應"), MatchString("禁止回應"), MatchString("沒有發表文章的權限")), err: ArticleNoPermissionError},
+		{matcher: MatchCursorLine("回應至"), keys: target},
+		{matcher: MatchCursorLine("採用原標題"), keys: "y\r"},
+		{matcher: MatchCursorLine("引用原文"), keys: "n\r"},
+		{matcher: matchAnyKey, keys: " "},
+	})
+	if err != nil {
+		logError("read reply command", err)
+		return "", err
+	}
+
+	if err = ptt.typeEditorText(ctx, body); err != nil {
+		return "", err
+	}
+	if err = ptt.saveEditor(ctx, matchBoard); err != nil {
+		return "", err
+	}
+
+	return ptt.queryNewArticleAid(ctx, func(entry *ArticleEntry) bool {
+		return entry.Reply && (original == nil || sameTitle(entry.Title, original.Title))
+	})
+}
+
+// queryNewArticleAid finds the article just posted on the last page of the board, the newest
+// entry of the account that matches, pinned entries at the bottom and newer articles of other
+// users are skipped
+func (ptt *PttClient) queryNewArticleAid(ctx context.Context, match func(entry *ArticleEntry) bool) (string, error) {
+	if err := ptt.sendKeysWait(ctx, Key("$")); err != nil {
+		logError("send board end", err)
+		return "", err
+	}
+	ptt.logDebug("find new article:\n%s\n", ptt.screen)
+	entries := parseArticleEntries(ptt.screen)
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := &entries[i]
+		if entry.Pinned || entry.Deleted || !strings.EqualFold(entry.Author, ptt.account) || !match(entry) {
+			continue
+		}
+		return ptt.queryAid(ctx, entry.Serial)
+	}
+	return "", NewArticleNotFoundError
+}
+
+// sameTitle compares titles of the board list, which are cut at the screen edge
+func sameTitle(listed string, title string) bool {
+	listed = strings.TrimSpace(listed)
+	title = strings.TrimSpace(title)
+	if listed == "" || title == "" {
+		return false
+	}
+	return strings.HasPrefix(title, listed) || strings.HasPrefix(listed, title)
+}
+
+// number of the category in the 種類 prompt, empty means no category
+func postCategoryOption(screen []byte, category string) string {
+	if category == "" {
+		return ""
+	}
+	for _, m := range postCategoryRegexp.FindAllSubmatch(screen, -1) {
+		if string(m[2]) == category {
+			return string(m[1])
+		}
+	}
+	return ""
+}
+
+func (ptt *PttClient) typeEditorText(ctx context.Context, text string) error {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		big5, err := Utf8ToUaoBig5(line)
+		if err != nil {
+			logError("encode editor line error", err)
+			return MsgEncodeError
+		}
+		if i < len(lines)-1 {
+			big5 += "\r"
+		}
+		if big5 == "" {
+			continue
+		}
+		if err = ptt.sendKeysWait(ctx, Text(big5)); err != nil {
+			logError("send editor line", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// save with Ctrl-X and go through the file menu and signature prompts until done shows up
+func (ptt *PttClient) saveEditor(ctx context.Context, done Matcher) error {
+	if err := ptt.sendKeys(ctx, Ctrl('X')); err != nil {
+		logError("send save editor", err)
+		return err
+	}
+	err := ptt.answerPrompts(ctx, ptt.timeout, maxPromptAnswers, []prompt{
+		{matcher: MatchCursorLine("檔案處理"), keys: "s\r"},
+		{matcher: MatchCursorLine("簽名檔"), keys: "0\r"},
+		{matcher: MatchCursorLine("自存底稿"), keys: "n\r"},
+		{matcher: matchAnyKey, keys: " "},
+		{matcher: done, done: true},
+	})
+	if err != nil {
+		logError("read save editor", err)
+		return err
+	}
+	return nil
+}
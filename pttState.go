@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+)
+
+var NotLoggedInError = errors.New("NOT_LOGGED_IN")
+var NoBoardError = errors.New("NO_BOARD")
+var NoArticleError = errors.New("NO_ARTICLE")
+var EscapeError = errors.New("ESCAPE_FAIL")
+
+// keys escape and backToMainMenu press before giving up
+const maxEscapeKeys = 10
+
+type PttState int
+
+const (
+	StateUnknown PttState = iota
+	StateLogin
+	StateMainMenu
+	StateBoardList
+	StateBoard
+	StateArticle
+	StateEditor
+	StatePopup
+)
+
+func (s PttState) String() string {
+	switch s {
+	case StateLogin:
+		return "login"
+	case StateMainMenu:
+		return "main menu"
+	case StateBoardList:
+		return "board list"
+	case StateBoard:
+		return "board"
+	case StateArticle:
+		return "article"
+	case StateEditor:
+		return "editor"
+	case StatePopup:
+		return "popup"
+	}
+	return "unknown"
+}
+
+// detectState returns StateUnknown for partial updates like echoed keys and for screens it
+// doesn't know, the previous state is kept while an operation runs and dropped when it ends
+func detectState(screen []byte) PttState {
+	switch {
+	case bytes.Contains(screen, []byte("按任意鍵繼續")) || bytes.Contains(screen, []byte("請按任意鍵")):
+		return StatePopup
+	case bytes.Contains(screen, []byte("編輯文章")):
+		return StateEditor
+	case pagerStatusRegexp.Match(screen):
+		return StateArticle
+	case bytes.Contains(screen, []byte("【板主:")) && bytes.Contains(screen, []byte("看板《")):
+		return StateBoard
+	case bytes.Contains(screen, []byte("看板列表")):
+		return StateBoardList
+	case bytes.Contains(screen, []byte("主功能表")):
+		return StateMainMenu
+	case bytes.Contains(screen, []byte("請輸入代號")) || bytes.Contains(screen, []byte("請輸入您的密碼")):
+		return StateLogin
+	}
+	return StateUnknown
+}
+
+func (ptt *PttClient) updateState() {
+	if state := detectState(ptt.screen); state != StateUnknown {
+		ptt.state = state
+	}
+}
+
+// Ctrl-L redraws the whole screen, so the state comes from a complete screen
+func (ptt *PttClient) refreshState(ctx context.Context) error {
+	if err := ptt.sendKeysWait(ctx, Ctrl('L')); err != nil {
+		logError("send redraw", err)
+		return err
+	}
+	ptt.viewLock.Lock()
+	ptt.state = detectState(ptt.screen)
+	ptt.viewLock.Unlock()
+	return nil
+}
+
+// GoTo moves to the main menu, or to the board and article last entered by EnterBoard and EnterArticle
+func (ptt *PttClient) GoTo(ctx context.Context, state PttState) error {
+	if err := ptt.acquire(ctx, "GoTo"); err != nil {
+		return err
+	}
+	defer ptt.release()
+	return ptt.goTo(ctx, state)
+}
+
+func (ptt *PttClient) goTo(ctx context.Context, state PttState) error {
+	switch state {
+	case StateMainMenu:
+		return ptt.backToMainMenu(ctx)
+	case StateBoard:
+		if ptt.board == "" {
+			return NoBoardError
+		}
+		if ptt.state == StateBoard {
+			return nil
+		}
+		if err := ptt.escape(ctx); err != nil {
+			return err
+		}
+		if ptt.state == StateBoard {
+			return nil
+		}
+		return ptt.enterBoard(ctx, ptt.board)
+	case StateArticle:
+		if ptt.article == "" {
+			return NoArticleError
+		}
+		if ptt.state == StateArticle {
+			return nil
+		}
+		if err := ptt.goTo(ctx, StateBoard); err != nil {
+			return err
+		}
+		return ptt.enterArticle(ctx, ptt.article)
+	}
+	return EscapeError
+}
+
+// escape presses keys until a screen where s and Ctrl-U work, unsaved editor content is dropped
+func (ptt *PttClient) escape(ctx context.Context) error {
+	if ptt.state == StateUnknown {
+		if err := ptt.refreshState(ctx); err != nil {
+			return err
+		}
+	}
+	for attempt := 0; attempt < maxEscapeKeys; attempt++ {
+		key := KeyLeft
+		switch ptt.state {
+		case StateMainMenu, StateBoardList, StateBoard:
+			return nil
+		case StateLogin:
+			return NotLoggedInError
+		case StatePopup:
+			key = KeySpace
+		case StateEditor:
+			key = Ctrl('X')
+		}
+		if bytes.Contains(ptt.screen, []byte("檔案處理")) {
+			key = "a\r"
+		}
+
+		if err := ptt.sendKeysWait(ctx, key); err != nil {
+			logError("send escape", err)
+			return err
+		}
+		if detectState(ptt.screen) == StateUnknown && !bytes.Contains(ptt.screen, []byte("檔案處理")) {
+			if err := ptt.refreshState(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return EscapeError
+}
+
+// press left until 主功能表 shows up
+func (ptt *PttClient) backToMainMenu(ctx context.Context) error {
+	if err := ptt.escape(ctx); err != nil {
+		return err
+	}
+	for attempt := 0; attempt < maxEscapeKeys; attempt++ {
+		if ptt.state == StateMainMenu {
+			return nil
+		}
+		if err := ptt.sendKeysWait(ctx, KeyLeft); err != nil {
+			logError("send back to main menu", err)
+			return err
+		}
+		if err := ptt.escape(ctx); err != nil {
+			return err
+		}
+	}
+	return MainMenuError
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// the user list is no screen detectState knows, the next operation escapes from it
+func TestEnterBoardAfterUserList(t *testing.T) {
+	ptt, _ := newFakeClient(t, 5)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	users, err := ptt.ListOnlineUsers(ctx, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Fatalf("users %+v", users)
+	}
+	if state := ptt.State(); state != StateUnknown {
+		t.Fatalf("state %s on the user list", state)
+	}
+	if err = ptt.EnterBoard(ctx, fakeBoardName); err != nil {
+		t.Fatal(err)
+	}
+	if state := ptt.State(); state != StateBoard {
+		t.Fatalf("state %s after EnterBoard", state)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type UserProfile struct {
+	Id         string    `json:"id"`
+	Nickname   string    `json:"nickname"`
+	LoginCount int       `json:"loginCount"`
+	ValidPosts int       `json:"validPosts"`
+	LastLogin  time.Time `json:"lastLogin"`
+	LastIp     string    `json:"lastIp"`
+	Mail       string    `json:"mail"`
+	Activity   string    `json:"activity"`
+	Online     bool      `json:"online"`
+}
+
+type cachedUserProfile struct {
+	profile UserProfile
+	expire  time.Time
+}
+
+var userIdRegexp = regexp.MustCompile(`(?m)《ＩＤ暱稱》\s*(\S+)\s+\((.*?)\)\s*(?:《|$)`)
+var userLoginCountRegexp = regexp.MustCompile(`《登入次數》\s*(\d+)`)
+var userValidPostsRegexp = regexp.MustCompile(`《\s*有效文章\s*》\s*(\d+)`)
+var userActivityRegexp = regexp.MustCompile(`(?m)《目前動態》\s*(.+?)\s*(?:《|$)`)
+var userMailRegexp = regexp.MustCompile(`(?m)《私人信箱》\s*(.+?)\s*(?:《|$)`)
+var userLastLoginRegexp = regexp.MustCompile(`《上次上站》\s*(\d{2}/\d{2}/\d{4} \d{2}:\d{2}:\d{2})`)
+var userLastIpRegexp = regexp.MustCompile(`《上次故鄉》\s*(\S+)`)
+
+// QueryUser looks up the user with 查詢網友 of the talk menu, results are cached for userCacheTTL
+func (ptt *PttClient) QueryUser(ctx context.Context, id string) (*UserProfile, error) {
+	key := strings.ToLower(id)
+	ptt.userCacheLock.Lock()
+	cached, ok := ptt.userCache[key]
+	ptt.userCacheLock.Unlock()
+	if ok && time.Now().Before(cached.expire) {
+		profile := cached.profile
+		return &profile, nil
+	}
+
+	profile, err := ptt.queryUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ptt.userCacheLock.Lock()
+	ptt.userCache[key] = cachedUserProfile{profile: *profile, expire: time.Now().Add(ptt.userCacheTTL)}
+	ptt.userCacheLock.Unlock()
+	return profile, nil
+}
+
+func (ptt *PttClient) queryUser(ctx context.Context, id string) (*UserProfile, error) {
+	if err := ptt.acquire(ctx, "QueryUser"); err != nil {
+		return nil, err
+	}
+	defer ptt.release()
+
+	err := ptt.backToMainMenu(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = ptt.selectMenu(ctx, "t", MatchLine(0, "聊天")); err != nil {
+		return nil, err
+	}
+	if err = ptt.selectMenu(ctx, "q", MatchCursorLine("代號")); err != nil {
+		return nil, err
+	}
+
+	if err = ptt.sendKeysWait(ctx, Text(id), KeyEnter); err != nil {
+		logError("send query user", err)
+		return nil, err
+	}
+	ptt.logDebug("query user----\n%s\n----\n", ptt.screen)
+	profile, ok := parseUserProfile(ptt.screen)
+
+	if err = ptt.sendKeysWait(ctx, KeySpace); err != nil {
+		logError("send leave query user", err)
+		return nil, err
+	}
+	if !ok {
+		return nil, UserNotFoundError
+	}
+	return profile, nil
+}
+
+func parseUserProfile(screen []byte) (*UserProfile, bool) {
+	m := userIdRegexp.FindSubmatch(screen)
+	if m == nil {
+		return nil, false
+	}
+	profile := &UserProfile{
+		Id:       string(m[1]),
+		Nickname: string(m[2]),
+	}
+	if m = userLoginCountRegexp.FindSubmatch(screen); m != nil {
+		profile.LoginCount, _ = strconv.Atoi(string(m[1]))
+	}
+	if m = userValidPostsRegexp.FindSubmatch(screen); m != nil {
+		profile.ValidPosts, _ = strconv.Atoi(string(m[1]))
+	}
+	if m = userActivityRegexp.FindSubmatch(screen); m != nil {
+		profile.Activity = string(m[1])
+	}
+	if m = userMailRegexp.FindSubmatch(screen); m != nil {
+		profile.Mail = string(m[1])
+	}
+	if m = userLastLoginRegexp.FindSubmatch(screen); m != nil {
+		profile.LastLogin, _ = time.ParseInLocation("01/02/2006 15:04:05", string(m[1]), time.Local)
+	}
+	if m = userLastIpRegexp.FindSubmatch(screen); m != nil {
+		profile.LastIp = string(m[1])
+	}
+	profile.Online = profile.Activity != "" && !strings.Contains(profile.Activity, "不在站上")
+	return profile, true
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var UserOfflineError = errors.New("USER_OFFLINE")
+
+type WaterBall struct {
+	From    string    `json:"from"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// ★sender message, PTT draws it on the top row over a colored background, article and
+// board lines starting with ★ are on the default background
+var waterBallRegexp = regexp.MustCompile(`^★([A-Za-z][A-Za-z0-9]{1,11}) +(.+?)\s*$`)
+
+const waterBallRow = 0
+
+// remove the water ball overlay from the screen and return it when new,
+// the overlay stays until the redraw so the same line is returned once
+func (ptt *PttClient) extractWaterBalls() []WaterBall {
+	lines := ptt.view.Lines()
+	var m [][]byte
+	if len(lines) > waterBallRow && len(ptt.view.Backgrounds) > waterBallRow && ptt.view.Backgrounds[waterBallRow] != 0 {
+		m = waterBallRegexp.FindSubmatch(lines[waterBallRow])
+	}
+	if m == nil {
+		ptt.lastWaterBall = nil
+		return nil
+	}
+
+	l := lines[waterBallRow]
+	lines[waterBallRow] = nil
+	ptt.view.Data = bytes.Join(lines, []byte("\n"))
+	if bytes.Equal(l, ptt.lastWaterBall) {
+		return nil
+	}
+	ptt.lastWaterBall = append([]byte(nil), l...)
+	return []WaterBall{{
+		From:    string(m[1]),
+		Message: string(m[2]),
+		Time:    time.Now(),
+	}}
+}
+
+func (ptt *PttClient) onWaterBall(w WaterBall) {
+	ptt.logDebug("water ball from %s: %s\n", w.From, w.Message)
+	if ptt.WaterBallHandler != nil {
+		ptt.WaterBallHandler(w)
+		return
+	}
+	fmt.Printf("水球 %s: %s %s\n", w.From, w.Message, w.Time)
+}
+
+func (ptt *PttClient) SendWaterBall(ctx context.Context, user string, text string) error {
+	big5, err := Utf8ToUaoBig5(text)
+	if err != nil {
+		logError("encode water ball error", err)
+		return MsgEncodeError
+	}
+
+	if err := ptt.acquire(ctx, "SendWaterBall"); err != nil {
+		return err
+	}
+	defer ptt.release()
+
+	if err = ptt.enterUserList(ctx); err != nil {
+		return err
+	}
+	if err = ptt.locateOnlineUser(ctx, user); err != nil {
+		return err
+	}
+
+	if err = ptt.sendKeysWait(ctx, Key("w")); err != nil {
+		logError("send water ball command", err)
+		return err
+	}
+	if !bytes.Contains(ptt.screen, []byte("水球")) {
+		return UserOfflineError
+	}
+
+	if err = ptt.sendKeysWait(ctx, Text(big5), KeyEnter); err != nil {
+		logError("send water ball text", err)
+		return err
+	}
+	if bytes.Contains(ptt.screen, []byte("確定")) {
+		if err = ptt.sendKeysWait(ctx, Key("y"), KeyEnter); err != nil {
+			logError("send water ball confirm", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// Ctrl-U lists the online users
+func (ptt *PttClient) enterUserList(ctx context.Context) error {
+	if err := ptt.backToMainMenu(ctx); err != nil {
+		return err
+	}
+	if err := ptt.sendKeysWait(ctx, Ctrl('U')); err != nil {
+		logError("send user list", err)
+		return err
+	}
+	return nil
+}
+
+// move the user list cursor to the user with s
+func (ptt *PttClient) locateOnlineUser(ctx context.Context, user string) error {
+	if err := ptt.sendKeysWait(ctx, Key("s")); err != nil {
+		logError("send search user", err)
+		return err
+	}
+	if err := ptt.sendKeysWait(ctx, Text(user), KeyEnter); err != nil {
+		logError("send search user id", err)
+		return err
+	}
+	if !bytes.Contains(bytes.ToLower(ptt.screen), bytes.ToLower([]byte(user))) {
+		return UserOfflineError
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// RaffleOptions are the eligibility rules and the draw
+type RaffleOptions struct {
+	// the push has to contain it, case-insensitive, any push when empty
+	Keyword string `json:"keyword"`
+	// 推, 噓 or →, any when empty
+	Types []string `json:"types"`
+	// pushes after it don't count, in the 01/02 15:04 of the pushes, zero for none
+	Deadline time.Time `json:"deadline"`
+	// only the first eligible push of a user enters
+	OneEntry bool `json:"oneEntry"`
+	// users who can't win, like the author
+	Exclude []string `json:"exclude"`
+	Winners int      `json:"winners"`
+	// the same seed and candidates draw the same winners
+	Seed int64 `json:"seed"`
+}
+
+// RaffleEntry is an eligible push, Floor is its number among the pushes of the article
+type RaffleEntry struct {
+	Floor   int       `json:"floor"`
+	Line    int       `json:"line"`
+	User    string    `json:"user"`
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// RaffleReport is everything needed to check a draw again
+type RaffleReport struct {
+	Board   string        `json:"board"`
+	Article string        `json:"article"`
+	Title   string        `json:"title"`
+	Options RaffleOptions `json:"options"`
+	Pushes  int           `json:"pushes"`
+	// hash of the candidates in order, the same article and rules give the same hash
+	CandidatesHash string        `json:"candidatesHash"`
+	Candidates     []RaffleEntry `json:"candidates"`
+	Winners        []RaffleEntry `json:"winners"`
+	Drawn          time.Time     `json:"drawn"`
+}
+
+// raffleCandidates returns the eligible pushes in article order
+func raffleCandidates(messages []Message, options RaffleOptions) []RaffleEntry {
+	keyword := strings.ToLower(options.Keyword)
+	exclude := lowerSet(options.Exclude)
+	entered := make(map[string]bool)
+	candidates := make([]RaffleEntry, 0)
+	for i := range messages {
+		m := &messages[i]
+		user := strings.ToLower(m.User)
+		if exclude[user] || (options.OneEntry && entered[user]) {
+			continue
+		}
+		if keyword != "" && !strings.Contains(strings.ToLower(m.Message), keyword) {
+			continue
+		}
+		if len(options.Types) > 0 {
+			found := false
+			for _, t := range options.Types {
+				found = found || t == m.Type
+			}
+			if !found {
+				continue
+			}
+		}
+		if !options.Deadline.IsZero() && m.Time.After(options.Deadline) {
+			continue
+		}
+		entered[user] = true
+		candidates = append(candidates, RaffleEntry{
+			Floor:   int(m.Id),
+			Line:    m.Line,
+			User:    m.User,
+			Type:    m.Type,
+			Message: m.Message,
+			Time:    m.Time,
+		})
+	}
+	return candidates
+}
+
+func candidatesHash(candidates []RaffleEntry) string {
+	h := sha256.New()
+	for _, c := range candidates {
+		fmt.Fprintf(h, "%d\x00%s\x00%s\x00%s\x00%s\n", c.Floor, c.Type, c.User, c.Message, c.Time.Format("01/02 15:04"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// drawWinners shuffles the candidates with the seed and takes the first entry of every user
+// until there are enough winners, a user with many entries still wins once
+func drawWinners(candidates []RaffleEntry, winners int, seed int64) []RaffleEntry {
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	rng := rand.New(rand.NewSource(seed))
+	for i := len(order) - 1; i > 0; i-- {
+		j := rng.Intn(i + 1)
+		order[i], order[j] = order[j], order[i]
+	}
+
+	won := make(map[string]bool)
+	result := make([]RaffleEntry, 0, winners)
+	for _, i := range order {
+		if len(result) >= winners {
+			break
+		}
+		user := strings.ToLower(candidates[i].User)
+		if won[user] {
+			continue
+		}
+		won[user] = true
+		result = append(result, candidates[i])
+	}
+	return result
+}
+
+// Raffle draws the winners of an article read by ReadArticle
+func Raffle(article *Article, options RaffleOptions) *RaffleReport {
+	if options.Winners <= 0 {
+		options.Winners = 1
+	}
+	candidates := raffleCandidates(article.Messages, options)
+	return &RaffleReport{
+		Board:          article.Board,
+		Article:        article.Aid,
+		Title:          article.Title,
+		Options:        options,
+		Pushes:         len(article.Messages),
+		CandidatesHash: candidatesHash(candidates),
+		Candidates:     candidates,
+		Winners:        drawWinners(candidates, options.Winners, options.Seed),
+		Drawn:          time.Now(),
+	}
+}
+
+func (r *RaffleReport) Print(w io.Writer) {
+	o := r.Options
+	fmt.Fprintf(w, "抽獎 %s %s %s\n", r.Board, r.Article, r.Title)
+	fmt.Fprintf(w, "時間 %s\n", r.Drawn.Format(time.RFC3339))
+	fmt.Fprintf(w, "種子 %d\n", o.Seed)
+	fmt.Fprintf(w, "條件 關鍵字=%q 推文類型=%s 截止=%s 每人一次=%t 排除=%s\n", o.Keyword, strings.Join(o.Types, ","),
+		formatDeadline(o.Deadline), o.OneEntry, strings.Join(o.Exclude, ","))
+	fmt.Fprintf(w, "推文 %d 則, 候選 %d 則, sha256 %s\n\n", r.Pushes, len(r.Candidates), r.CandidatesHash)
+	for _, c := range r.Candidates {
+		printRaffleEntry(w, c)
+	}
+	fmt.Fprintf(w, "\n得獎 %d 名\n", len(r.Winners))
+	for _, c := range r.Winners {
+		printRaffleEntry(w, c)
+	}
+}
+
+func printRaffleEntry(w io.Writer, c RaffleEntry) {
+	fmt.Fprintf(w, "%4d樓 %s %-12s %s %s\n", c.Floor, c.Type, c.User, c.Time.Format("01/02 15:04"), c.Message)
+}
+
+func formatDeadline(t time.Time) string {
+	if t.IsZero() {
+		return "無"
+	}
+	return t.Format("01/02 15:04")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func raffleMessages() []Message {
+	users := []string{"alice", "bob", "carol", "dave", "erin", "frank", "bob", "author", "grace", "alice"}
+	types := []string{"推", "推", "→", "推", "噓", "推", "推", "推", "推", "推"}
+	messages := make([]Message, len(users))
+	for i := range users {
+		messages[i] = Message{
+			Id:      int32(i + 1),
+			Line:    20 + i,
+			User:    users[i],
+			Type:    types[i],
+			Message: fmt.Sprintf("+1 抽 %d", i+1),
+			Time:    time.Date(0, 4, 1, 20, i, 0, 0, time.UTC),
+		}
+	}
+	return messages
+}
+
+func candidateFloors(candidates []RaffleEntry) []int {
+	floors := make([]int, len(candidates))
+	for i, c := range candidates {
+		floors[i] = c.Floor
+	}
+	return floors
+}
+
+func TestRaffleCandidates(t *testing.T) {
+	deadline, _ := ParseTallyTime("04/01 20:08")
+	cases := []struct {
+		name    string
+		options RaffleOptions
+		floors  []int
+	}{
+		{"all", RaffleOptions{}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{"keyword", RaffleOptions{Keyword: "抽 1"}, []int{1, 10}},
+		{"types", RaffleOptions{Types: []string{"推"}}, []int{1, 2, 4, 6, 7, 8, 9, 10}},
+		{"deadline", RaffleOptions{Deadline: deadline}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"one entry", RaffleOptions{OneEntry: true}, []int{1, 2, 3, 4, 5, 6, 8, 9}},
+		{"exclude", RaffleOptions{Exclude: []string{"Author"}}, []int{1, 2, 3, 4, 5, 6, 7, 9, 10}},
+	}
+	for _, c := range cases {
+		if floors := candidateFloors(raffleCandidates(raffleMessages(), c.options)); !reflect.DeepEqual(floors, c.floors) {
+			t.Errorf("%s: floors %v, want %v", c.name, floors, c.floors)
+		}
+	}
+}
+
+// the same seed and candidates always draw the same winners, a user wins once
+func TestDrawWinners(t *testing.T) {
+	candidates := raffleCandidates(raffleMessages(), RaffleOptions{})
+	if floors := candidateFloors(drawWinners(candidates, 3, 42)); !reflect.DeepEqual(floors, []int{4, 8, 3}) {
+		t.Fatalf("seed 42 drew %v", floors)
+	}
+
+	won := make(map[string]bool)
+	for _, w := range drawWinners(candidates, len(candidates), 7) {
+		if won[w.User] {
+			t.Fatalf("%s won twice", w.User)
+		}
+		won[w.User] = true
+	}
+	if len(won) != 8 {
+		t.Fatalf("%d winners of 8 users", len(won))
+	}
+}
+
+// the hash covers floor, type, user, content and time of every candidate in order
+func TestCandidatesHash(t *testing.T) {
+	candidates := raffleCandidates(raffleMessages(), RaffleOptions{})
+	const want = "ddb4fe553a18431a8bf036338d0fa5402737162d238e37012206c8967376589c"
+	if hash := candidatesHash(candidates); hash != want {
+		t.Fatalf("hash %s, want %s", hash, want)
+	}
+	candidates[3].Message += "!"
+	if candidatesHash(candidates) == want {
+		t.Fatal("hash unchanged after a candidate changed")
+	}
+}
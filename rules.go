@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var RuleConfigError = errors.New("RULE_CONFIG")
+
+// Rule matches a message when every condition set matches, rules run in order
+type Rule struct {
+	Name string `json:"name"`
+	// users to match, empty for anyone, case-insensitive
+	Users        []string `json:"users"`
+	ExcludeUsers []string `json:"excludeUsers"`
+	// regexp on the content
+	Pattern        string `json:"pattern"`
+	ExcludePattern string `json:"excludePattern"`
+	// 推, 噓 or →, empty for any
+	Types []string `json:"types"`
+	// time of day window like 20:00 to 02:00 of the push time, empty for any
+	From string `json:"from"`
+	To   string `json:"to"`
+	// drop, keep, tag or highlight, a message matching no keep rule is dropped when there is one
+	Action string `json:"action"`
+	Tag    string `json:"tag"`
+
+	users          map[string]bool
+	excludeUsers   map[string]bool
+	pattern        *regexp.Regexp
+	excludePattern *regexp.Regexp
+	from           int
+	to             int
+}
+
+const (
+	ruleDrop      = "drop"
+	ruleKeep      = "keep"
+	ruleTag       = "tag"
+	ruleHighlight = "highlight"
+)
+
+func (r *Rule) compile() error {
+	switch r.Action {
+	case ruleDrop, ruleKeep, ruleHighlight:
+	case ruleTag:
+		if r.Tag == "" {
+			return fmt.Errorf("%w: rule %q tags without a tag", RuleConfigError, r.Name)
+		}
+	default:
+		return fmt.Errorf("%w: rule %q has unknown action %q", RuleConfigError, r.Name, r.Action)
+	}
+
+	r.users = lowerSet(r.Users)
+	r.excludeUsers = lowerSet(r.ExcludeUsers)
+	var err error
+	if r.Pattern != "" {
+		if r.pattern, err = regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("%w: rule %q: %s", RuleConfigError, r.Name, err)
+		}
+	}
+	if r.ExcludePattern != "" {
+		if r.excludePattern, err = regexp.Compile(r.ExcludePattern); err != nil {
+			return fmt.Errorf("%w: rule %q: %s", RuleConfigError, r.Name, err)
+		}
+	}
+	r.from, r.to = -1, -1
+	if r.From != "" || r.To != "" {
+		if r.from, err = parseTimeOfDay(r.From); err != nil {
+			return fmt.Errorf("%w: rule %q: %s", RuleConfigError, r.Name, err)
+		}
+		if r.to, err = parseTimeOfDay(r.To); err != nil {
+			return fmt.Errorf("%w: rule %q: %s", RuleConfigError, r.Name, err)
+		}
+	}
+	return nil
+}
+
+func lowerSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[strings.ToLower(v)] = true
+	}
+	return set
+}
+
+// parseTimeOfDay returns the minutes of HH:MM since midnight
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (r *Rule) Match(m *Message) bool {
+	user := strings.ToLower(m.User)
+	if len(r.users) > 0 && !r.users[user] {
+		return false
+	}
+	if r.excludeUsers[user] {
+		return false
+	}
+	if r.pattern != nil && !r.pattern.MatchString(m.Message) {
+		return false
+	}
+	if r.excludePattern != nil && r.excludePattern.MatchString(m.Message) {
+		return false
+	}
+	if len(r.Types) > 0 {
+		found := false
+		for _, t := range r.Types {
+			found = found || t == m.Type
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.from >= 0 {
+		minute := m.Time.Hour()*60 + m.Time.Minute()
+		// the window may go over midnight
+		if r.from <= r.to && (minute < r.from || minute > r.to) {
+			return false
+		}
+		if r.from > r.to && minute < r.from && minute > r.to {
+			return false
+		}
+	}
+	return true
+}
+
+// applyRules returns the messages the rules don't drop, tagged and highlighted
+func applyRules(rules []Rule, messages []Message) []Message {
+	keeps := false
+	for i := range rules {
+		keeps = keeps || rules[i].Action == ruleKeep
+	}
+
+	result := make([]Message, 0, len(messages))
+	for _, m := range messages {
+		kept := !keeps
+		dropped := false
+		for i := range rules {
+			r := &rules[i]
+			if !r.Match(&m) {
+				continue
+			}
+			switch r.Action {
+			case ruleDrop:
+				dropped = true
+			case ruleKeep:
+				kept = true
+			case ruleTag:
+				m.Tags = append(append([]string(nil), m.Tags...), r.Tag)
+			case ruleHighlight:
+				m.Highlight = true
+			}
+			if dropped {
+				break
+			}
+		}
+		if kept && !dropped {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// RuleEngine applies the rules of a JSON file, the file is read again when its mtime changes
+// and a broken edit keeps the rules loaded before
+type RuleEngine struct {
+	lock    sync.Mutex
+	path    string
+	modTime time.Time
+	// mtime of a broken edit, so it is logged once and not on every poll
+	failed time.Time
+	rules  []Rule
+}
+
+func NewRuleEngine(path string) (*RuleEngine, error) {
+	e := &RuleEngine{path: path}
+	if err := e.reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *RuleEngine) reload() error {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(e.modTime) || info.ModTime().Equal(e.failed) {
+		return nil
+	}
+	rules, err := readRules(e.path)
+	if err != nil {
+		e.failed = info.ModTime()
+		return err
+	}
+	e.rules = rules
+	e.modTime = info.ModTime()
+	return nil
+}
+
+func readRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%w: %s", RuleConfigError, err)
+	}
+	for i := range rules {
+		if err = rules[i].compile(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+func (e *RuleEngine) Apply(messages []Message) []Message {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if err := e.reload(); err != nil {
+		logError("reload rules", err)
+	}
+	return applyRules(e.rules, messages)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type opPriority int
+
+// higher runs first when the terminal is released
+const (
+	priorityPoll opPriority = iota
+	priorityUser
+	priorityCount
+)
+
+// OpStats is the latency of one kind of operation, Wait is the time queued for the terminal
+// and Run the time holding it
+type OpStats struct {
+	Count     int           `json:"count"`
+	Coalesced int           `json:"coalesced"`
+	TotalWait time.Duration `json:"totalWait"`
+	MaxWait   time.Duration `json:"maxWait"`
+	TotalRun  time.Duration `json:"totalRun"`
+	MaxRun    time.Duration `json:"maxRun"`
+}
+
+func (s OpStats) AvgWait() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.TotalWait / time.Duration(s.Count)
+}
+
+func (s OpStats) AvgRun() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.TotalRun / time.Duration(s.Count)
+}
+
+// scheduler hands the terminal to one operation at a time, user operations before polls
+// and in arrival order within a priority
+type scheduler struct {
+	lock    sync.Mutex
+	busy    bool
+	waiting [priorityCount][]chan struct{}
+	current string
+	started time.Time
+	stats   map[string]*OpStats
+	polls   map[string]*pollCall
+}
+
+// pollCall is one poll shared by everyone asking for the same key before it finishes,
+// abandoned when it failed only because the ctx of the caller running it was done
+type pollCall struct {
+	done      chan struct{}
+	screen    Screen
+	err       error
+	abandoned bool
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		stats: make(map[string]*OpStats),
+		polls: make(map[string]*pollCall),
+	}
+}
+
+func (s *scheduler) acquire(ctx context.Context, op string, priority opPriority) error {
+	queued := time.Now()
+	s.lock.Lock()
+	if !s.busy {
+		s.busy = true
+		s.start(op, queued)
+		s.lock.Unlock()
+		return nil
+	}
+	granted := make(chan struct{})
+	s.waiting[priority] = append(s.waiting[priority], granted)
+	s.lock.Unlock()
+
+	select {
+	case <-granted:
+		s.lock.Lock()
+		s.start(op, queued)
+		s.lock.Unlock()
+		return nil
+	case <-ctx.Done():
+		s.lock.Lock()
+		if s.dequeue(priority, granted) {
+			s.lock.Unlock()
+			return ctx.Err()
+		}
+		// granted at the same time, pass the terminal on
+		s.lock.Unlock()
+		s.release()
+		return ctx.Err()
+	}
+}
+
+// start records the wait of the operation taking the terminal, s.lock is held
+func (s *scheduler) start(op string, queued time.Time) {
+	now := time.Now()
+	stats := s.opStats(op)
+	stats.Count++
+	wait := now.Sub(queued)
+	stats.TotalWait += wait
+	if wait > stats.MaxWait {
+		stats.MaxWait = wait
+	}
+	s.current = op
+	s.started = now
+}
+
+func (s *scheduler) release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.current != "" {
+		stats := s.opStats(s.current)
+		run := time.Since(s.started)
+		stats.TotalRun += run
+		if run > stats.MaxRun {
+			stats.MaxRun = run
+		}
+		s.current = ""
+	}
+	for p := priorityCount - 1; p >= 0; p-- {
+		if len(s.waiting[p]) > 0 {
+			granted := s.waiting[p][0]
+			s.waiting[p] = s.waiting[p][1:]
+			close(granted)
+			return
+		}
+	}
+	s.busy = false
+}
+
+// dequeue drops a waiter that gave up, false when it was already granted
+func (s *scheduler) dequeue(priority opPriority, granted chan struct{}) bool {
+	for i, ch := range s.waiting[priority] {
+		if ch == granted {
+			s.waiting[priority] = append(s.waiting[priority][:i], s.waiting[priority][i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *scheduler) opStats(op string) *OpStats {
+	stats, ok := s.stats[op]
+	if !ok {
+		stats = &OpStats{}
+		s.stats[op] = stats
+	}
+	return stats
+}
+
+// coalesce runs poll once for all callers asking for key while it is queued or running,
+// poll runs under the ctx of the caller that started it, when that caller gives up the
+// others still waiting start it again with their own poll
+func (s *scheduler) coalesce(ctx context.Context, op string, key string, poll func() (Screen, error)) (Screen, error) {
+	for {
+		s.lock.Lock()
+		call, ok := s.polls[key]
+		if !ok {
+			break
+		}
+		s.opStats(op).Coalesced++
+		s.lock.Unlock()
+		select {
+		case <-call.done:
+			if call.abandoned && ctx.Err() == nil {
+				continue
+			}
+			return call.screen, call.err
+		case <-ctx.Done():
+			return Screen{}, ctx.Err()
+		}
+	}
+	call := &pollCall{done: make(chan struct{})}
+	s.polls[key] = call
+	s.lock.Unlock()
+
+	call.screen, call.err = poll()
+	call.abandoned = call.err != nil && ctx.Err() != nil
+	s.lock.Lock()
+	delete(s.polls, key)
+	s.lock.Unlock()
+	close(call.done)
+	return call.screen, call.err
+}
+
+func (s *scheduler) snapshot() map[string]OpStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	result := make(map[string]OpStats, len(s.stats))
+	for op, stats := range s.stats {
+		result[op] = *stats
+	}
+	return result
+}
+
+// Stats returns the latency of every operation run so far by name
+func (ptt *PttClient) Stats() map[string]OpStats {
+	return ptt.scheduler.snapshot()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"testing"
+)
+
+// a waiter whose ctx is done while the terminal is handed to it passes the terminal on
+func TestAcquireCancelledWhileGranted(t *testing.T) {
+	for round := 0; round < 1000; round++ {
+		s := newScheduler()
+		if err := s.acquire(context.Background(), "Holder", priorityUser); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if s.acquire(ctx, "Waiter", priorityPoll) == nil {
+				s.release()
+			}
+		}()
+		for queued := false; !queued; runtime.Gosched() {
+			s.lock.Lock()
+			queued = len(s.waiting[priorityPoll]) == 1
+			s.lock.Unlock()
+		}
+
+		// the waiter wakes up with both its ctx done and the terminal granted
+		cancel()
+		s.release()
+		<-done
+
+		s.lock.Lock()
+		busy, waiting := s.busy, len(s.waiting[priorityPoll])
+		s.lock.Unlock()
+		if busy || waiting > 0 {
+			t.Fatalf("round %d: busy %v with %d waiting", round, busy, waiting)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// runServe keeps one logged in client and serves it as JSON:
+//
+//	GET  /articles?board=&pages=      ListArticles
+//	GET  /article?board=&article=     ReadArticle
+//	POST /push {board, article, message}
+//	GET  /tally?board=&article=&options=&last=&start=&end=&from-floor=&to-floor=
+//	GET  /stats                        latency of every operation
+func runServe(ctx context.Context, flags *flag.FlagSet, options *cliOptions, args []string) error {
+	addr := flags.String("addr", "127.0.0.1:8080", "address to listen on")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	ptt, err := login(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer logout(ptt)
+
+	server := &http.Server{Addr: *addr, Handler: newServeMux(ptt, options)}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	if err = server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return ctx.Err()
+}
+
+func newServeMux(ptt *PttClient, options *cliOptions) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/articles", func(w http.ResponseWriter, r *http.Request) {
+		board := queryOr(r, "board", options.board)
+		pages, _ := strconv.Atoi(r.URL.Query().Get("pages"))
+		entries, err := ptt.ListArticles(r.Context(), board, ListArticlesOptions{Pages: pages})
+		writeJSON(w, entries, err)
+	})
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		article, err := ptt.ReadArticle(r.Context(), queryOr(r, "board", options.board), queryOr(r, "article", options.article))
+		writeJSON(w, article, err)
+	})
+	mux.HandleFunc("/push", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Board   string `json:"board"`
+			Article string `json:"article"`
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Message == "" {
+			http.Error(w, "board, article and message are expected", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, req, ptt.PushTo(r.Context(), req.Board, req.Article, req.Message))
+	})
+	mux.HandleFunc("/tally", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		lastWins, _ := strconv.ParseBool(q.Get("last"))
+		fromFloor, _ := strconv.Atoi(q.Get("from-floor"))
+		toFloor, _ := strconv.Atoi(q.Get("to-floor"))
+		tallyOptions, err := parseTallyOptions(q.Get("options"), lastWins, q.Get("start"), q.Get("end"), fromFloor, toFloor)
+		if err != nil {
+			writeJSON(w, nil, err)
+			return
+		}
+		article, err := ptt.ReadArticle(r.Context(), queryOr(r, "board", options.board), queryOr(r, "article", options.article))
+		if err != nil {
+			writeJSON(w, nil, err)
+			return
+		}
+		tally := NewTally(tallyOptions)
+		tally.Add(article.Messages)
+		writeJSON(w, tally.Result(), nil)
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, ptt.Stats(), nil)
+	})
+	return mux
+}
+
+func queryOr(r *http.Request, key string, def string) string {
+	if v := r.URL.Query().Get(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(httpStatus(err))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error(), "message": describeError(err)})
+		return
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpStatus(err error) int {
+	switch exitCode(err) {
+	case exitUsage:
+		return http.StatusBadRequest
+	case exitNotFound:
+		return http.StatusNotFound
+	case exitOverload:
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, BoardNoPermissionError) || errors.Is(err, BoardOver18Error) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadGateway
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var SinkConfigError = errors.New("SINK_CONFIG")
+
+// Sink receives the new messages of a watched article
+type Sink interface {
+	Write(ctx context.Context, board string, article string, messages []Message) error
+	Close() error
+}
+
+// sinkRecord is one message with the article it came from, as written by the file and socket sinks
+type sinkRecord struct {
+	Board   string `json:"board"`
+	Article string `json:"article"`
+	Message
+}
+
+// SinkConfig is one entry of the sinks file, Article is an AID, file name or URL
+// of the article it is for, empty or * for every article
+type SinkConfig struct {
+	Article string `json:"article"`
+	// jsonl, csv, webhook or unix
+	Type string `json:"type"`
+	// file of jsonl and csv, socket of unix
+	Path string `json:"path"`
+	// jsonl rotates to path.1 ... path.MaxFiles when the file grows over MaxBytes, 0 never rotates
+	MaxBytes int64  `json:"maxBytes"`
+	MaxFiles int    `json:"maxFiles"`
+	URL      string `json:"url"`
+	// the webhook body is signed with HMAC-SHA256 in X-Signature-256 when set
+	Secret  string `json:"secret"`
+	Retries int    `json:"retries"`
+	// like 10s, 10s when empty
+	Timeout string `json:"timeout"`
+}
+
+// LoadSinks reads the sinks file, a JSON array of SinkConfig, and opens the sinks for the article
+func LoadSinks(path string, board string, article string) (Sink, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []SinkConfig
+	if err = json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("%w: %s", SinkConfigError, err)
+	}
+	_, aid, err := ParseArticleRef(article)
+	if err != nil {
+		return nil, err
+	}
+
+	sinks := &multiSink{}
+	for _, config := range configs {
+		if config.Article != "" && config.Article != "*" {
+			_, configAid, err := ParseArticleRef(config.Article)
+			if err != nil {
+				sinks.Close()
+				return nil, fmt.Errorf("%w: %s", SinkConfigError, err)
+			}
+			if configAid != aid {
+				continue
+			}
+		}
+		sink, err := OpenSink(config)
+		if err != nil {
+			sinks.Close()
+			return nil, err
+		}
+		sinks.sinks = append(sinks.sinks, sink)
+	}
+	sinks.delivered = make([][]Message, len(sinks.sinks))
+	return sinks, nil
+}
+
+func OpenSink(config SinkConfig) (Sink, error) {
+	switch strings.ToLower(config.Type) {
+	case "jsonl":
+		return NewJSONLinesSink(config.Path, config.MaxBytes, config.MaxFiles)
+	case "csv":
+		return NewCSVSink(config.Path)
+	case "webhook":
+		var timeout time.Duration
+		if config.Timeout != "" {
+			var err error
+			if timeout, err = time.ParseDuration(config.Timeout); err != nil {
+				return nil, fmt.Errorf("%w: %s", SinkConfigError, err)
+			}
+		}
+		return NewWebhookSink(config.URL, config.Secret, config.Retries, timeout)
+	case "unix":
+		return NewUnixSocketSink(config.Path), nil
+	}
+	return nil, fmt.Errorf("%w: unknown sink type %q", SinkConfigError, config.Type)
+}
+
+// multiSink writes to every sink, one failing sink doesn't stop the others. A failed batch
+// comes again from its start with the next poll and every sink only gets what it didn't have
+type multiSink struct {
+	sinks []Sink
+	// the start of the batch each sink already got while another one failed
+	delivered [][]Message
+}
+
+func (s *multiSink) Write(ctx context.Context, board string, article string, messages []Message) error {
+	var errs []error
+	for i, sink := range s.sinks {
+		if fresh := undelivered(s.delivered[i], messages); len(fresh) > 0 {
+			if err := sink.Write(ctx, board, article, fresh); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		s.delivered[i] = messages
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	for i := range s.delivered {
+		s.delivered[i] = nil
+	}
+	return nil
+}
+
+// undelivered returns the messages after delivered, all of them when the batch doesn't start
+// with delivered anymore
+func undelivered(delivered []Message, messages []Message) []Message {
+	if len(delivered) > len(messages) {
+		return messages
+	}
+	for i := range delivered {
+		if messageHash(&delivered[i]) != messageHash(&messages[i]) {
+			return messages
+		}
+	}
+	return messages[len(delivered):]
+}
+
+func (s *multiSink) Close() error {
+	var errs []error
+	for _, sink := range s.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
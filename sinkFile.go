@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// JSONLinesSink appends one JSON object per message, the file is rotated by size
+type JSONLinesSink struct {
+	lock     sync.Mutex
+	path     string
+	maxBytes int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func NewJSONLinesSink(path string, maxBytes int64, maxFiles int) (*JSONLinesSink, error) {
+	if maxFiles <= 0 {
+		maxFiles = 5
+	}
+	s := &JSONLinesSink{path: path, maxBytes: maxBytes, maxFiles: maxFiles}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *JSONLinesSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate moves path to path.1, path.1 to path.2 and so on, the oldest one is dropped
+func (s *JSONLinesSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxFiles))
+	for i := s.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *JSONLinesSink) Write(ctx context.Context, board string, article string, messages []Message) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i := range messages {
+		line, err := json.Marshal(sinkRecord{Board: board, Article: article, Message: messages[i]})
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+		if s.maxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+			if err = s.rotate(); err != nil {
+				return err
+			}
+		}
+		n, err := s.file.Write(line)
+		s.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *JSONLinesSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.file.Close()
+}
+
+var csvHeader = []string{"board", "article", "id", "time", "type", "user", "message"}
+
+// CSVSink appends one row per message, the header is written when the file is new
+type CSVSink struct {
+	lock   sync.Mutex
+	file   *os.File
+	writer *csv.Writer
+}
+
+func NewCSVSink(path string) (*CSVSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	s := &CSVSink{file: file, writer: csv.NewWriter(file)}
+	if info.Size() == 0 {
+		s.writer.Write(csvHeader)
+	}
+	return s, nil
+}
+
+func (s *CSVSink) Write(ctx context.Context, board string, article string, messages []Message) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, m := range messages {
+		err := s.writer.Write([]string{board, article, strconv.Itoa(int(m.Id)), m.Time.Format(time.RFC3339), m.Type, m.User, m.Message})
+		if err != nil {
+			return err
+		}
+	}
+	s.writer.Flush()
+	return s.writer.Error()
+}
+
+func (s *CSVSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.writer.Flush()
+	return s.file.Close()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	webhookRetryDelay    = 500 * time.Millisecond
+	webhookMaxRetryDelay = 30 * time.Second
+	webhookQueueSize     = 64
+	webhookDrainTimeout  = 10 * time.Second
+)
+
+var SinkQueueFullError = errors.New("SINK_QUEUE_FULL")
+
+// WebhookSink posts {board, article, messages} as JSON from a bounded queue so a slow or
+// failing receiver doesn't stall polling. A batch that fails its retries stays at the head
+// and is retried with a capped backoff, Write refuses new batches until it is delivered
+type WebhookSink struct {
+	url     string
+	secret  []byte
+	retries int
+	client  *http.Client
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	queue  chan []byte
+	done   chan struct{}
+
+	lock   sync.Mutex
+	closed bool
+	// the error of the batch at the head after its retries, nil while delivering
+	failing error
+	// batches left in the queue when Close gave up
+	undelivered int
+}
+
+func NewWebhookSink(url string, secret string, retries int, timeout time.Duration) (*WebhookSink, error) {
+	if url == "" {
+		return nil, fmt.Errorf("%w: webhook needs a url", SinkConfigError)
+	}
+	if retries < 0 {
+		retries = 0
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &WebhookSink{
+		url:     url,
+		secret:  []byte(secret),
+		retries: retries,
+		client:  &http.Client{Timeout: timeout},
+		ctx:     ctx,
+		cancel:  cancel,
+		queue:   make(chan []byte, webhookQueueSize),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Write queues the messages, it fails while the queue is full or a batch is failing so the
+// caller keeps its checkpoint and writes them again later
+func (s *WebhookSink) Write(ctx context.Context, board string, article string, messages []Message) error {
+	body, err := json.Marshal(map[string]interface{}{"board": board, "article": article, "messages": messages})
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return fmt.Errorf("webhook %s: closed", s.url)
+	}
+	if s.failing != nil {
+		return s.failing
+	}
+	select {
+	case s.queue <- body:
+		return nil
+	default:
+		return fmt.Errorf("%w: webhook %s", SinkQueueFullError, s.url)
+	}
+}
+
+func (s *WebhookSink) setFailing(err error) {
+	s.lock.Lock()
+	s.failing = err
+	s.lock.Unlock()
+}
+
+// run delivers the queue in order until it is closed and drained or the sink is cancelled
+func (s *WebhookSink) run() {
+	defer close(s.done)
+	for body := range s.queue {
+		if !s.deliver(body) {
+			s.lock.Lock()
+			s.undelivered = len(s.queue) + 1
+			s.lock.Unlock()
+			return
+		}
+	}
+}
+
+// deliver posts body until it is accepted or rejected, false when the sink was cancelled
+func (s *WebhookSink) deliver(body []byte) bool {
+	delay := webhookRetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(s.ctx, body)
+		if err == nil || !retry {
+			if err != nil {
+				// the receiver refused the batch, sending it again won't change that
+				logError("webhook", err)
+			}
+			s.setFailing(nil)
+			return true
+		}
+		if attempt >= s.retries {
+			s.setFailing(err)
+		}
+		logError("webhook retry", err)
+		if sleepContext(s.ctx, delay) != nil {
+			return false
+		}
+		delay = minDuration(delay*2, webhookMaxRetryDelay)
+	}
+}
+
+func minDuration(a time.Duration, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// post returns whether a failure is worth retrying, 4xx other than 429 is not
+func (s *WebhookSink) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.secret) > 0 {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook %s: %s", s.url, resp.Status)
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// Close waits a while for the queue to drain, the batches still queued after it are lost
+func (s *WebhookSink) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.lock.Unlock()
+
+	select {
+	case <-s.done:
+	case <-time.After(webhookDrainTimeout):
+		s.cancel()
+		<-s.done
+	}
+	s.cancel()
+	s.client.CloseIdleConnections()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.undelivered > 0 {
+		return fmt.Errorf("webhook %s: %d batches not delivered", s.url, s.undelivered)
+	}
+	return nil
+}
+
+// UnixSocketSink writes JSON lines to a local socket some other program listens on,
+// it dials again on the next write after a failure
+type UnixSocketSink struct {
+	lock sync.Mutex
+	path string
+	conn net.Conn
+}
+
+func NewUnixSocketSink(path string) *UnixSocketSink {
+	return &UnixSocketSink{path: path}
+}
+
+func (s *UnixSocketSink) Write(ctx context.Context, board string, article string, messages []Message) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i := range messages {
+		if err := encoder.Encode(sinkRecord{Board: board, Article: article, Message: messages[i]}); err != nil {
+			return err
+		}
+	}
+
+	if s.conn == nil {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "unix", s.path)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	}
+	if _, err := s.conn.Write(buf.Bytes()); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *UnixSocketSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type recordingSink struct {
+	fail     bool
+	messages []string
+}
+
+func (s *recordingSink) Write(ctx context.Context, board string, article string, messages []Message) error {
+	if s.fail {
+		return errors.New("down")
+	}
+	for _, m := range messages {
+		s.messages = append(s.messages, m.Message)
+	}
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+// while one sink fails the batch grows with every poll, the healthy sink gets each push once
+func TestMultiSinkFailingSink(t *testing.T) {
+	healthy, failing := &recordingSink{}, &recordingSink{fail: true}
+	sinks := &multiSink{sinks: []Sink{healthy, failing}, delivered: make([][]Message, 2)}
+
+	var batch []Message
+	for i, text := range []string{"a", "b", "c", "d", "e"} {
+		batch = append(batch, Message{User: "u", Type: "推", Message: text})
+		if i == 3 {
+			failing.fail = false
+		}
+		err := sinks.Write(context.Background(), "Test", "#1ZxYwVuT", batch)
+		if err == nil {
+			batch = nil
+		} else if i >= 3 {
+			t.Fatalf("write %d: %s", i, err)
+		}
+	}
+
+	want := "a b c d e"
+	for name, sink := range map[string]*recordingSink{"healthy": healthy, "failing": failing} {
+		got := ""
+		for i, m := range sink.messages {
+			if i > 0 {
+				got += " "
+			}
+			got += m
+		}
+		if got != want {
+			t.Errorf("%s sink got %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TallyOptions picks which pushes are votes
+type TallyOptions struct {
+	// the valid options, case-insensitive, any first word of a push counts when empty
+	Options []string
+	// the last vote of a user replaces the earlier ones, otherwise the first one stays
+	LastWins bool
+	// push time range in the 01/02 15:04 of the pushes, zero for open
+	Start time.Time
+	End   time.Time
+	// floor (樓, the number of the push in the article) range of the vote, 0 for open
+	FromFloor int
+	ToFloor   int
+}
+
+// ParseTallyTime parses the time of a push, 01/02 15:04, the year is unknown like in the pushes
+func ParseTallyTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("01/02 15:04", s)
+}
+
+// parseTallyOptions builds the options from the flags of tally and the query of /tally
+func parseTallyOptions(options string, lastWins bool, start string, end string, fromFloor int, toFloor int) (TallyOptions, error) {
+	o := TallyOptions{Options: splitList(options), LastWins: lastWins, FromFloor: fromFloor, ToFloor: toFloor}
+	var err error
+	if o.Start, err = ParseTallyTime(start); err != nil {
+		return o, fmt.Errorf("%w: start: %s", usageError, err)
+	}
+	if o.End, err = ParseTallyTime(end); err != nil {
+		return o, fmt.Errorf("%w: end: %s", usageError, err)
+	}
+	return o, nil
+}
+
+type tallyVote struct {
+	Option string
+	Floor  int
+	Time   time.Time
+}
+
+// TallyCount is the votes of one option
+type TallyCount struct {
+	Option string `json:"option"`
+	Votes  int    `json:"votes"`
+}
+
+// TallyResult is the running result, Counts is sorted by votes
+type TallyResult struct {
+	Voters  int          `json:"voters"`
+	Counts  []TallyCount `json:"counts"`
+	Ignored int          `json:"ignored"`
+	// the floor of the last vote counted
+	LastFloor int `json:"lastFloor"`
+}
+
+// Tally counts one vote per user from the pushes it is fed, safe to read while fed
+type Tally struct {
+	lock    sync.Mutex
+	options TallyOptions
+	valid   map[string]string
+	votes   map[string]tallyVote
+	ignored int
+	last    int
+	// floor of the last push fed, the pushes are numbered as they come
+	floor int
+}
+
+func NewTally(options TallyOptions) *Tally {
+	t := &Tally{options: options, votes: make(map[string]tallyVote)}
+	if len(options.Options) > 0 {
+		t.valid = make(map[string]string, len(options.Options))
+		for _, o := range options.Options {
+			t.valid[strings.ToUpper(o)] = o
+		}
+	}
+	return t
+}
+
+// vote returns the option of the push, false when it is no vote
+func (t *Tally) vote(m *Message, floor int) (string, bool) {
+	o := t.options
+	if o.FromFloor > 0 && floor < o.FromFloor {
+		return "", false
+	}
+	if o.ToFloor > 0 && floor > o.ToFloor {
+		return "", false
+	}
+	if !o.Start.IsZero() && m.Time.Before(o.Start) {
+		return "", false
+	}
+	if !o.End.IsZero() && m.Time.After(o.End) {
+		return "", false
+	}
+	fields := strings.Fields(m.Message)
+	if len(fields) == 0 {
+		return "", false
+	}
+	option := strings.ToUpper(fields[0])
+	if t.valid == nil {
+		return option, true
+	}
+	option, ok := t.valid[option]
+	return option, ok
+}
+
+// Add counts the votes in the messages, every push is expected once, in article order and
+// from the first push so the floors are right: the whole article first and then the pushes
+// pulled after its last one
+func (t *Tally) Add(messages []Message) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for i := range messages {
+		m := &messages[i]
+		t.floor++
+		option, ok := t.vote(m, t.floor)
+		if !ok {
+			t.ignored++
+			continue
+		}
+		user := strings.ToLower(m.User)
+		if _, voted := t.votes[user]; voted && !t.options.LastWins {
+			continue
+		}
+		t.votes[user] = tallyVote{Option: option, Floor: t.floor, Time: m.Time}
+		t.last = t.floor
+	}
+}
+
+func (t *Tally) Result() TallyResult {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	counts := make(map[string]int)
+	for _, o := range t.options.Options {
+		counts[o] = 0
+	}
+	for _, v := range t.votes {
+		counts[v.Option]++
+	}
+	result := TallyResult{Voters: len(t.votes), Ignored: t.ignored, LastFloor: t.last, Counts: make([]TallyCount, 0, len(counts))}
+	for option, votes := range counts {
+		result.Counts = append(result.Counts, TallyCount{Option: option, Votes: votes})
+	}
+	sort.Slice(result.Counts, func(i, j int) bool {
+		if result.Counts[i].Votes != result.Counts[j].Votes {
+			return result.Counts[i].Votes > result.Counts[j].Votes
+		}
+		return result.Counts[i].Option < result.Counts[j].Option
+	})
+	return result
+}
+
+func (r TallyResult) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d voters", r.Voters)
+	for _, c := range r.Counts {
+		percent := 0.0
+		if r.Voters > 0 {
+			percent = float64(c.Votes) * 100 / float64(r.Voters)
+		}
+		fmt.Fprintf(&b, "\n  %-8s %5d  %5.1f%%", c.Option, c.Votes, percent)
+	}
+	return b.String()
+}
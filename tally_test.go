@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func votes(lines ...string) []Message {
+	messages := make([]Message, 0, len(lines))
+	for i := 0; i+1 < len(lines); i += 2 {
+		messages = append(messages, Message{
+			User:    lines[i],
+			Type:    "推",
+			Message: lines[i+1],
+			Line:    30 + i/2,
+			Time:    time.Date(0, 4, 1, 20, i/2, 0, 0, time.UTC),
+		})
+	}
+	return messages
+}
+
+func TestTally(t *testing.T) {
+	pushes := votes("alice", "1", "bob", "2 我投這個", "Alice", "2", "carol", "x", "dave", "3", "bob", "1")
+	start, _ := ParseTallyTime("04/01 20:01")
+	end, _ := ParseTallyTime("04/01 20:04")
+	cases := []struct {
+		name    string
+		options TallyOptions
+		counts  []TallyCount
+		ignored int
+		last    int
+	}{
+		{"first wins", TallyOptions{Options: []string{"1", "2", "3"}},
+			[]TallyCount{{"1", 1}, {"2", 1}, {"3", 1}}, 1, 5},
+		{"last wins", TallyOptions{Options: []string{"1", "2", "3"}, LastWins: true},
+			[]TallyCount{{"1", 1}, {"2", 1}, {"3", 1}}, 1, 6},
+		{"any first word", TallyOptions{},
+			[]TallyCount{{"1", 1}, {"2", 1}, {"3", 1}, {"X", 1}}, 0, 5},
+		{"floors", TallyOptions{Options: []string{"1", "2", "3"}, FromFloor: 2, ToFloor: 5},
+			[]TallyCount{{"2", 2}, {"3", 1}, {"1", 0}}, 3, 5},
+		{"times", TallyOptions{Options: []string{"1", "2", "3"}, Start: start, End: end},
+			[]TallyCount{{"2", 2}, {"3", 1}, {"1", 0}}, 3, 5},
+	}
+	for _, c := range cases {
+		tally := NewTally(c.options)
+		tally.Add(pushes)
+		result := tally.Result()
+		if !reflect.DeepEqual(result.Counts, c.counts) || result.Ignored != c.ignored || result.LastFloor != c.last {
+			t.Errorf("%s: %+v, want counts %+v ignored %d last floor %d", c.name, result, c.counts, c.ignored, c.last)
+		}
+	}
+}
+
+// the pulled pushes go on with the floors of the article, even when an edit of the body
+// moved them to lower lines
+func TestTallyFloorsAcrossBatches(t *testing.T) {
+	tally := NewTally(TallyOptions{Options: []string{"1", "2"}, FromFloor: 3})
+	tally.Add(votes("alice", "1", "bob", "2"))
+	pulled := votes("carol", "1", "dave", "2")
+	for i := range pulled {
+		pulled[i].Line = 10 + i
+	}
+	tally.Add(pulled)
+
+	result := tally.Result()
+	if result.Voters != 2 || result.LastFloor != 4 || result.Ignored != 2 {
+		t.Fatalf("%+v", result)
+	}
+}
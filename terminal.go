@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"golang.org/x/text/transform"
+	"strconv"
+)
+
+const screenRows = 24
+const screenCols = 80
+
+// Screen is a rendered snapshot of the terminal, Data holds the UTF-8 rows joined by \n
+type Screen struct {
+	Data    []byte
+	Row     int
+	Col     int
+	Version uint64
+	// background color of the first cell of every row, 40 to 47, 0 for the default
+	Backgrounds []byte
+}
+
+func (s *Screen) Lines() [][]byte {
+	return bytes.Split(s.Data, []byte("\n"))
+}
+
+func (s *Screen) Line(n int) []byte {
+	lines := s.Lines()
+	if n < 0 || n >= len(lines) {
+		return nil
+	}
+	return lines[n]
+}
+
+// most prompts are typed on the cursor line
+func (s *Screen) CursorLine() []byte {
+	return s.Line(s.Row)
+}
+
+// Terminal keeps the 80x24 screen PTT draws with VT100 sequences, cells hold raw Big5 bytes
+// and backgrounds the background color each cell was drawn with
+type Terminal struct {
+	cells       [][]byte
+	backgrounds [][]byte
+	background  byte
+	row         int
+	col         int
+	savedRow    int
+	savedCol    int
+	top         int
+	bottom      int
+	pending     []byte
+	version     uint64
+}
+
+func NewTerminal() *Terminal {
+	t := &Terminal{bottom: screenRows - 1}
+	t.cells = make([][]byte, screenRows)
+	t.backgrounds = make([][]byte, screenRows)
+	for i := range t.cells {
+		t.clearRow(i)
+	}
+	return t
+}
+
+func blankRow() []byte {
+	return bytes.Repeat([]byte(" "), screenCols)
+}
+
+func (t *Terminal) clearRow(row int) {
+	t.cells[row] = blankRow()
+	t.backgrounds[row] = make([]byte, screenCols)
+}
+
+// clearCells blanks the cells of the row from col, n of them
+func (t *Terminal) clearCells(row int, col int, n int) {
+	copy(t.cells[row][col:col+n], bytes.Repeat([]byte(" "), n))
+	copy(t.backgrounds[row][col:col+n], make([]byte, n))
+}
+
+func (t *Terminal) Write(data []byte) {
+	data = append(t.pending, data...)
+	t.pending = nil
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '\x1b':
+			n, ok := t.escape(data[i:])
+			if !ok {
+				// sequence continues in the next frame
+				t.pending = append([]byte(nil), data[i:]...)
+				i = len(data)
+				continue
+			}
+			i += n - 1
+		case '\r':
+			t.col = 0
+		case '\n':
+			t.index()
+		case '\b':
+			if t.col > 0 {
+				t.col--
+			}
+		case '\t':
+			t.col = minInt(t.col+8-t.col%8, screenCols-1)
+		case '\a', 0:
+		default:
+			if t.col >= screenCols {
+				t.col = 0
+				t.index()
+			}
+			t.cells[t.row][t.col] = c
+			t.backgrounds[t.row][t.col] = t.background
+			t.col++
+		}
+	}
+	t.version++
+}
+
+// escape handles the sequence at the head of data, returns its length or false when incomplete
+func (t *Terminal) escape(data []byte) (int, bool) {
+	if len(data) < 2 {
+		return 0, false
+	}
+	switch data[1] {
+	case '[':
+	case 'M':
+		t.reverseIndex()
+		return 2, true
+	case 'D':
+		t.index()
+		return 2, true
+	case 'E':
+		t.col = 0
+		t.index()
+		return 2, true
+	case '7':
+		t.savedRow, t.savedCol = t.row, t.col
+		return 2, true
+	case '8':
+		t.row, t.col = t.savedRow, t.savedCol
+		return 2, true
+	default:
+		return 2, true
+	}
+
+	end := 2
+	for ; end < len(data); end++ {
+		if data[end] >= 0x40 && data[end] <= 0x7e {
+			break
+		}
+	}
+	if end >= len(data) {
+		return 0, false
+	}
+
+	params := make([]int, 0, 2)
+	for _, p := range bytes.Split(bytes.TrimLeft(data[2:end], "?"), []byte(";")) {
+		n, _ := strconv.Atoi(string(p))
+		params = append(params, n)
+	}
+	param := func(i int, def int) int {
+		if i < len(params) && params[i] > 0 {
+			return params[i]
+		}
+		return def
+	}
+
+	switch data[end] {
+	case 'H', 'f':
+		t.row = clamp(param(0, 1)-1, 0, screenRows-1)
+		t.col = clamp(param(1, 1)-1, 0, screenCols-1)
+	case 'A':
+		t.row = clamp(t.row-param(0, 1), 0, screenRows-1)
+	case 'B':
+		t.row = clamp(t.row+param(0, 1), 0, screenRows-1)
+	case 'C':
+		t.col = clamp(t.col+param(0, 1), 0, screenCols-1)
+	case 'D':
+		t.col = clamp(t.col-param(0, 1), 0, screenCols-1)
+	case 'J':
+		t.eraseDisplay(param(0, 0))
+	case 'K':
+		t.eraseLine(t.row, param(0, 0))
+	case 'L':
+		for i := 0; i < param(0, 1); i++ {
+			t.scrollDown(t.row)
+		}
+	case 'M':
+		for i := 0; i < param(0, 1); i++ {
+			t.scrollUp(t.row)
+		}
+	case '@':
+		n := minInt(param(0, 1), screenCols-t.col)
+		for _, row := range [][]byte{t.cells[t.row], t.backgrounds[t.row]} {
+			copy(row[t.col+n:], row[t.col:])
+		}
+		t.clearCells(t.row, t.col, n)
+	case 'P':
+		n := minInt(param(0, 1), screenCols-t.col)
+		for _, row := range [][]byte{t.cells[t.row], t.backgrounds[t.row]} {
+			copy(row[t.col:], row[t.col+n:])
+		}
+		t.clearCells(t.row, screenCols-n, n)
+	case 'm':
+		// only the background is kept, 0 resets every attribute
+		for _, p := range params {
+			switch {
+			case p == 0 || p == 49:
+				t.background = 0
+			case p >= 40 && p <= 47:
+				t.background = byte(p)
+			}
+		}
+	case 'r':
+		t.top = clamp(param(0, 1)-1, 0, screenRows-1)
+		t.bottom = clamp(param(1, screenRows)-1, t.top, screenRows-1)
+		t.row, t.col = 0, 0
+	case 's':
+		t.savedRow, t.savedCol = t.row, t.col
+	case 'u':
+		t.row, t.col = t.savedRow, t.savedCol
+	}
+	return end + 1, true
+}
+
+func (t *Terminal) index() {
+	if t.row == t.bottom {
+		t.scrollUp(t.top)
+	} else if t.row < screenRows-1 {
+		t.row++
+	}
+}
+
+func (t *Terminal) reverseIndex() {
+	if t.row == t.top {
+		t.scrollDown(t.top)
+	} else if t.row > 0 {
+		t.row--
+	}
+}
+
+// drop the row and pull up the rows below it inside the scroll region
+func (t *Terminal) scrollUp(from int) {
+	if from < t.top || from > t.bottom {
+		return
+	}
+	copy(t.cells[from:t.bottom+1], t.cells[from+1:t.bottom+1])
+	copy(t.backgrounds[from:t.bottom+1], t.backgrounds[from+1:t.bottom+1])
+	t.clearRow(t.bottom)
+}
+
+// insert a blank row and push down the rows below it inside the scroll region
+func (t *Terminal) scrollDown(from int) {
+	if from < t.top || from > t.bottom {
+		return
+	}
+	copy(t.cells[from+1:t.bottom+1], t.cells[from:t.bottom])
+	copy(t.backgrounds[from+1:t.bottom+1], t.backgrounds[from:t.bottom])
+	t.clearRow(from)
+}
+
+func (t *Terminal) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		t.eraseLine(t.row, 0)
+		for i := t.row + 1; i < screenRows; i++ {
+			t.clearRow(i)
+		}
+	case 1:
+		t.eraseLine(t.row, 1)
+		for i := 0; i < t.row; i++ {
+			t.clearRow(i)
+		}
+	default:
+		for i := range t.cells {
+			t.clearRow(i)
+		}
+	}
+}
+
+func (t *Terminal) eraseLine(row int, mode int) {
+	switch mode {
+	case 0:
+		t.clearCells(row, t.col, screenCols-t.col)
+	case 1:
+		t.clearCells(row, 0, minInt(t.col+1, screenCols))
+	default:
+		t.clearRow(row)
+	}
+}
+
+func (t *Terminal) Snapshot() Screen {
+	rows := make([][]byte, len(t.cells))
+	backgrounds := make([]byte, len(t.cells))
+	for i, row := range t.cells {
+		backgrounds[i] = t.backgrounds[i][0]
+		utf8, _, err := transform.Bytes(NewUaoDecoder(), bytes.TrimRight(row, " "))
+		if err != nil {
+			utf8 = row
+		}
+		rows[i] = utf8
+	}
+	return Screen{
+		Data:        bytes.Join(rows, []byte("\n")),
+		Row:         t.row,
+		Col:         t.col,
+		Version:     t.version,
+		Backgrounds: backgrounds,
+	}
+}
+
+func clamp(n int, low int, high int) int {
+	if n < low {
+		return low
+	}
+	return minInt(n, high)
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
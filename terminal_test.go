@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func snapshotOf(frames ...string) Screen {
+	t := NewTerminal()
+	for _, f := range frames {
+		t.Write([]byte(f))
+	}
+	return t.Snapshot()
+}
+
+func big5(t *testing.T, s string) string {
+	b, err := Utf8ToUaoBig5(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestTerminalWrite(t *testing.T) {
+	lines := "\x1b[1;1Hrow0\x1b[2;1Hrow1\x1b[3;1Hrow2\x1b[4;1Hrow3\x1b[5;1Hrow4"
+	cases := []struct {
+		name   string
+		frames []string
+		rows   []string
+		row    int
+		col    int
+	}{
+		{"cursor position", []string{"\x1b[2;3Hab"}, []string{"", "  ab"}, 1, 4},
+		{"cursor moves", []string{"\x1b[5;5H\x1b[2A\x1b[3D\x1b[B\x1b[4Cx"}, []string{"", "", "", "     x"}, 3, 6},
+		{"escape split over frames", []string{"ab\x1b[", "2;", "3Hc"}, []string{"ab", "  c"}, 1, 3},
+		{"insert chars", []string{"abcdef\x1b[1;3H\x1b[2@XY"}, []string{"abXYcdef"}, 0, 4},
+		{"delete chars", []string{"abcdef\x1b[1;3H\x1b[2P"}, []string{"abef"}, 0, 2},
+		{"erase to line end", []string{"abcdef\x1b[1;3H\x1b[K"}, []string{"ab"}, 0, 2},
+		{"erase to cursor", []string{"abcdef\x1b[1;3H\x1b[1K"}, []string{"   def"}, 0, 2},
+		{"erase line", []string{"abcdef\x1b[1;3H\x1b[2K"}, []string{""}, 0, 2},
+		{"erase below", []string{lines, "\x1b[2;3H\x1b[J"}, []string{"row0", "ro", "", ""}, 1, 2},
+		{"erase above", []string{lines, "\x1b[2;3H\x1b[1J"}, []string{"", "   1", "row2"}, 1, 2},
+		{"erase screen", []string{lines, "\x1b[2J"}, []string{"", "", "", "", ""}, 4, 4},
+		{"insert lines", []string{lines, "\x1b[2;1H\x1b[2L"}, []string{"row0", "", "", "row1", "row2"}, 1, 0},
+		{"delete lines", []string{lines, "\x1b[2;1H\x1b[2M"}, []string{"row0", "row3", "row4", ""}, 1, 0},
+		// rows 2 to 4 scroll, the rows outside the region stay
+		{"scroll region", []string{lines, "\x1b[2;4r\x1b[4;1H\n"}, []string{"row0", "row2", "row3", "", "row4"}, 3, 0},
+		{"reverse index in region", []string{lines, "\x1b[2;4r\x1b[2;1H\x1bM"}, []string{"row0", "", "row1", "row2", "row4"}, 1, 0},
+		{"save and restore cursor", []string{"\x1b[3;4H\x1b7\x1b[1;1Ha\x1b8b"}, []string{"a", "", "   b"}, 2, 4},
+		{"wrap at the last column", []string{strings.Repeat("a", screenCols) + "b"}, []string{strings.Repeat("a", screenCols), "b"}, 1, 1},
+		{"big5", []string{big5(t, "【主功能表】")}, []string{"【主功能表】"}, 0, 12},
+	}
+	for _, c := range cases {
+		screen := snapshotOf(c.frames...)
+		for i, want := range c.rows {
+			if got := string(screen.Line(i)); got != want {
+				t.Errorf("%s: row %d %q, want %q", c.name, i, got, want)
+			}
+		}
+		if screen.Row != c.row || screen.Col != c.col {
+			t.Errorf("%s: cursor %d,%d, want %d,%d", c.name, screen.Row, screen.Col, c.row, c.col)
+		}
+	}
+}
+
+// a Big5 character split between two frames is decoded once both halves are in
+func TestTerminalBig5SplitFrames(t *testing.T) {
+	b := big5(t, "看板《Test》")
+	screen := snapshotOf(b[:3], b[3:])
+	if got := string(screen.Line(0)); got != "看板《Test》" {
+		t.Fatalf("row %q", got)
+	}
+}
+
+// a Big5 character cut by column 80 keeps its lead byte at the end of the row, the text
+// around it still decodes
+func TestTerminalBig5CutAtLastColumn(t *testing.T) {
+	ni := big5(t, "你")
+	screen := snapshotOf(strings.Repeat("a", screenCols-1) + ni + "bc" + big5(t, "中文"))
+	if got := string(screen.Line(0)); got != strings.Repeat("a", screenCols-1)+ni[:1] {
+		t.Errorf("row 0 %q", got)
+	}
+	if got := string(screen.Line(1)); got != ni[1:]+"bc中文" {
+		t.Errorf("row 1 %q", got)
+	}
+}
+
+func TestTerminalBackgrounds(t *testing.T) {
+	screen := snapshotOf("\x1b[1;37;44m water \x1b[m\x1b[2;1Hplain\x1b[3;1H\x1b[41m\x1b[0mreset")
+	if want := []byte{44, 0, 0}; string(screen.Backgrounds[:3]) != string(want) {
+		t.Fatalf("backgrounds %v, want %v", screen.Backgrounds[:3], want)
+	}
+	// erasing a row takes its color away
+	screen = snapshotOf("\x1b[44mtop\x1b[m\x1b[1;1H\x1b[2K")
+	if screen.Backgrounds[0] != 0 {
+		t.Fatalf("background %d after erase", screen.Backgrounds[0])
+	}
+}
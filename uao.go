@@ -2,9 +2,10 @@ package main
 
 import (
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"golang.org/x/text/transform"
+	"os"
+	"unicode/utf8"
 )
 
 type UaoDecoder struct {
@@ -15,19 +16,28 @@ func (c *UaoDecoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err
 	size := 0
 	for ; nSrc < len(src); nSrc += size {
 		byteW := src[nSrc]
+		if nDst+utf8.UTFMax > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
 		if byteW > 0x80 {
+			if nSrc+1 >= len(src) {
+				if !atEOF {
+					return nDst, nSrc, transform.ErrShortSrc
+				}
+				// lead byte cut by the end of a screen row
+				dst[nDst] = byteW
+				size = 1
+				nDst += 1
+				continue
+			}
 			k := binary.BigEndian.Uint16(src[nSrc : nSrc+2])
 			r, ok := B2U[int(k)]
 			if !ok {
-				fmt.Printf("decode fail: %d %c %s\n", k, byteW, src[nSrc:nSrc+2])
+				fmt.Fprintf(os.Stderr, "decode fail: %d %c %s\n", k, byteW, src[nSrc:nSrc+2])
 				dst[nDst] = src[nSrc]
-				size = 1
-				nDst = 1
-				if nSrc+1 < len(src) {
-					dst[nDst+1] = src[nSrc+1]
-					size += 1
-					nDst += 1
-				}
+				dst[nDst+1] = src[nSrc+1]
+				size = 2
+				nDst += 2
 				continue
 			}
 			elems := []byte(string(r))
@@ -57,8 +67,7 @@ func Utf8ToUaoBig5(src string) (dst string, err error) {
 		}
 		t, ok := U2B[string(s)]
 		if !ok {
-			fmt.Printf("%c\n", s)
-			return "", errors.New("encode error")
+			return "", fmt.Errorf("encode error: no Big5 for %q", s)
 		}
 		dst += t
 	}